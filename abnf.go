@@ -0,0 +1,326 @@
+package peg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// abnfCoreRules are the core rules of RFC 5234 Appendix B, added to imported
+// grammars which use them without definition.
+const abnfCoreRules = `
+ALPHA  = %x41-5A / %x61-7A
+BIT    = "0" / "1"
+CHAR   = %x01-7F
+CR     = %x0D
+CRLF   = CR LF
+CTL    = %x00-1F / %x7F
+DIGIT  = %x30-39
+DQUOTE = %x22
+HEXDIG = DIGIT / "A" / "B" / "C" / "D" / "E" / "F"
+HTAB   = %x09
+LF     = %x0A
+LWSP   = *(WSP / CRLF WSP)
+OCTET  = %x00-FF
+SP     = %x20
+VCHAR  = %x21-7E
+WSP    = SP / HTAB
+`
+
+func (im *importer) abnfGrammar() {
+	im.abnfResolve(im.abnfRulelist())
+}
+
+// abnfRulelist returns rules by lowercase names.
+func (im *importer) abnfRulelist() map[string]*Rule {
+	defs := map[string]*Rule{}
+
+	for {
+		im.abnfSpace(-1)
+		if im.peek(0) == -1 {
+			break
+		}
+
+		start := im.n
+		col := im.col(start)
+		name := im.abnfRulename()
+		if name == "" {
+			im.errorf(im.n, "expect rule name")
+		}
+		im.abnfSpace(col)
+		incremental := im.accept("=/")
+		if !incremental {
+			im.expect("=")
+		}
+		im.abnfSpace(col)
+		ce := im.abnfAlternation(col)
+		im.abnfSpace(col)
+		if c := im.peek(0); c != '\n' && c != '\r' && c != -1 {
+			im.errorf(im.n, "unexpected %q", c)
+		}
+
+		key := strings.ToLower(name)
+		if rule, ok := defs[key]; ok {
+			if !incremental {
+				im.errorf(start, "rule %s redefined", name)
+			}
+			rule.ChoiceExpr.ActionExprs = append(rule.ChoiceExpr.ActionExprs, ce.ActionExprs...)
+			continue
+		}
+		if incremental {
+			im.errorf(start, "rule %s not defined", name)
+		}
+		rule := &Rule{Name: im.name(strings.Replace(name, "-", "_", -1), start), ChoiceExpr: ce}
+		defs[key] = rule
+		im.tree.RuleList = append(im.tree.RuleList, rule)
+	}
+	return defs
+}
+
+// abnfResolve resolves references to rules names case-insensitively, and adds
+// the core rules used without definition.
+func (im *importer) abnfResolve(defs map[string]*Rule) {
+	core := (&importer{
+		format:  FormatABNF,
+		src:     []rune(abnfCoreRules),
+		tree:    &Tree{&Grammar{}},
+		renamed: map[string]string{},
+	}).abnfRulelist()
+
+	for i := 0; i < len(im.tree.RuleList); i++ {
+		abnfRefs(im.tree.RuleList[i].ChoiceExpr, func(pe *PrimaryExpr) {
+			key := strings.ToLower(pe.Expr.(*RuleRef).Name)
+			if _, ok := defs[key]; !ok {
+				if rule, ok := core[key]; ok {
+					defs[key] = rule
+					im.tree.RuleList = append(im.tree.RuleList, rule)
+				}
+			}
+			if rule, ok := defs[key]; ok {
+				*pe = *NewPrimaryExpr(&RuleRef{rule.Name})
+			}
+		})
+	}
+}
+
+// abnfRefs calls f with primary expressions referring to rules in ce.
+func abnfRefs(ce *ChoiceExpr, f func(*PrimaryExpr)) {
+	for _, ae := range ce.ActionExprs {
+		for _, le := range ae.SeqExpr.LabeledExprs {
+			pe := le.PrefixedExpr.SuffixedExpr.PrimaryExpr
+			switch e := pe.Expr.(type) {
+			case *RuleRef:
+				f(pe)
+			case *SubExpr:
+				abnfRefs(e.ChoiceExpr, f)
+			}
+		}
+	}
+}
+
+// abnfSpace skips spaces and comments, and line breaks followed by a line
+// indented more than col, the column of the rule name.
+func (im *importer) abnfSpace(col int) {
+	for {
+		switch im.peek(0) {
+		case ' ', '\t':
+			im.n++
+		case ';':
+			for c := im.peek(0); c != -1 && c != '\n' && c != '\r'; c = im.peek(0) {
+				im.n++
+			}
+		case '\r', '\n':
+			if col < 0 {
+				im.n++
+				continue
+			}
+			n := im.n
+			for {
+				for c := im.peek(0); c == ' ' || c == '\t' || c == '\r' || c == '\n'; c = im.peek(0) {
+					im.n++
+				}
+				if im.peek(0) != ';' {
+					break
+				}
+				for c := im.peek(0); c != -1 && c != '\n'; c = im.peek(0) {
+					im.n++
+				}
+			}
+			if im.peek(0) == -1 || im.col(im.n) <= col {
+				im.n = n
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// col returns the column of n.
+func (im *importer) col(n int) int {
+	col := 1
+	for n > 0 && im.src[n-1] != '\n' {
+		n--
+		col++
+	}
+	return col
+}
+
+// abnfRulename returns ALPHA *(ALPHA / DIGIT / "-"), or "".
+func (im *importer) abnfRulename() string {
+	start := im.n
+	for c := im.peek(0); isLetter(c) || im.n > start && (isDigit(c) || c == '-'); c = im.peek(0) {
+		im.n++
+	}
+	return string(im.src[start:im.n])
+}
+
+func (im *importer) abnfAlternation(col int) *ChoiceExpr {
+	ce := &ChoiceExpr{}
+	for {
+		ce.ActionExprs = append(ce.ActionExprs, im.abnfConcatenation(col))
+		im.abnfSpace(col)
+		if !im.accept("/") {
+			return ce
+		}
+		im.abnfSpace(col)
+	}
+}
+
+func (im *importer) abnfConcatenation(col int) *ActionExpr {
+	les := []*LabeledExpr{}
+	for {
+		im.abnfSpace(col)
+		switch c := im.peek(0); {
+		case isLetter(c) || isDigit(c) || c == '*' || c == '(' || c == '[' || c == '"' || c == '%' || c == '<':
+			les = append(les, im.abnfRepetition(col))
+			continue
+		}
+		if len(les) == 0 {
+			im.errorf(im.n, "expect element")
+		}
+		return sequence(les...)
+	}
+}
+
+func (im *importer) abnfRepetition(col int) *LabeledExpr {
+	min, max := 1, 1
+	n := im.number()
+	if im.accept("*") {
+		min, max = n, im.number()
+		if min < 0 {
+			min = 0
+		}
+	} else if n >= 0 {
+		min, max = n, n
+	}
+	if max >= 0 && max < min {
+		im.errorf(im.n, "maximum less than minimum")
+	}
+
+	le := im.abnfElement(col)
+	if min == 1 && max == 1 {
+		return le
+	}
+	return repeat(group([]*LabeledExpr{le}), min, max)
+}
+
+func (im *importer) abnfElement(col int) *LabeledExpr {
+	start := im.n
+	switch c := im.peek(0); {
+	case isLetter(c):
+		name := im.abnfRulename()
+		return item(&RuleRef{im.name(strings.Replace(name, "-", "_", -1), start)}, 0)
+	case c == '(' || c == '[':
+		im.n++
+		im.abnfSpace(col)
+		ce := im.abnfAlternation(col)
+		im.abnfSpace(col)
+		if c == '(' {
+			im.expect(")")
+			return item(&SubExpr{ce}, 0)
+		}
+		im.expect("]")
+		return item(&SubExpr{ce}, QUESTION)
+	case c == '"':
+		return item(caseless(im.abnfCharVal()), 0)
+	case c == '%':
+		im.n++
+		switch im.peek(0) {
+		case 's', 'S':
+			im.n++
+			return item(&LitMatcher{im.abnfCharVal()}, 0)
+		case 'i', 'I':
+			im.n++
+			return item(caseless(im.abnfCharVal()), 0)
+		}
+		return item(im.abnfNumVal(), 0)
+	case c == '<':
+		for !im.accept(">") {
+			if c := im.peek(0); c == -1 || c == '\n' || c == '\r' {
+				im.errorf(start, "unterminated prose value")
+			}
+			im.n++
+		}
+		// fails, so that later alternatives can match
+		im.warnf(start, "prose value %s imported as !\"\"", string(im.src[start:im.n]))
+		le := item(&LitMatcher{""}, 0)
+		le.PrefixedExpr.PrefixOp = NOT
+		return le
+	}
+	im.errorf(start, "expect element")
+	return nil
+}
+
+func (im *importer) abnfCharVal() string {
+	start := im.n
+	im.expect(`"`)
+	for !im.accept(`"`) {
+		if c := im.peek(0); c == -1 || c == '\n' || c == '\r' {
+			im.errorf(start, "unterminated string")
+		}
+		im.n++
+	}
+	return string(im.src[start+1 : im.n-1])
+}
+
+// abnfNumVal returns a matcher of a value, a range or a concatenation of
+// values after '%'.
+func (im *importer) abnfNumVal() Expr {
+	base := 0
+	switch im.peek(0) {
+	case 'b', 'B':
+		base = 2
+	case 'd', 'D':
+		base = 10
+	case 'x', 'X':
+		base = 16
+	default:
+		im.errorf(im.n, "expect b, d or x")
+	}
+	im.n++
+
+	value := func() rune {
+		start := im.n
+		for {
+			if _, err := strconv.ParseUint(string(im.peek(0)), base, 8); err != nil {
+				break
+			}
+			im.n++
+		}
+		v, err := strconv.ParseUint(string(im.src[start:im.n]), base, 32)
+		if err != nil || v > 0x10FFFF {
+			im.errorf(start, "invalid value")
+		}
+		return rune(v)
+	}
+
+	v := value()
+	if im.accept("-") {
+		return &ClassMatcher{&CharRange{Chars: []*Char{newCharRange(v, value())}}}
+	}
+	s := []rune{v}
+	for im.accept(".") {
+		s = append(s, value())
+	}
+	return &LitMatcher{string(s)}
+}
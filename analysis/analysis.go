@@ -0,0 +1,421 @@
+// Package analysis computes properties of grammars shared by linters,
+// optimizers and documentation tools: nullability, FIRST and FOLLOW sets,
+// the rule dependency graph, reachability and strongly connected components.
+package analysis
+
+import (
+	peg "github.com/laurence6/PEG.go"
+)
+
+// Analysis is the result of Analyze. Maps are keyed by rule names, and lists
+// of rules are in the order of the grammar unless noted.
+type Analysis struct {
+	Tree  *peg.Tree
+	Start string // first rule
+
+	// Nullable reports whether a rule can succeed without consuming input.
+	Nullable map[string]bool
+	// First is the set of characters or tokens which can start a match of a
+	// rule, including those of %skip in syntactic rules.
+	First map[string]*Set
+	// Follow is the set of characters or tokens which can follow a match of
+	// a rule. Anything can follow expressions in predicates and %skip.
+	Follow map[string]*Set
+
+	// AltNullable and AltFirst are Nullable and First of each alternative of
+	// choices, for choice dispatch.
+	AltNullable map[*peg.ActionExpr]bool
+	AltFirst    map[*peg.ActionExpr]*Set
+
+	// Refs are rules referenced by a rule, in order of first reference.
+	Refs map[string][]string
+	// LeftRefs are rules which a rule can reference before consuming input.
+	LeftRefs map[string][]string
+	// Reachable reports whether a rule is referenced from the start rule or
+	// %skip.
+	Reachable map[string]bool
+
+	// SCCs are strongly connected components of Refs, in reverse topological
+	// order, so that a component only references components before it.
+	SCCs [][]string
+	// Recursive reports whether a rule can reference itself.
+	Recursive map[string]bool
+	// LeftRecursive reports whether a rule can reference itself before
+	// consuming input, which a PEG parser does not terminate on.
+	LeftRecursive map[string]bool
+
+	rules     map[string]*peg.Rule
+	skipFirst *Set
+}
+
+// Analyze computes properties of tree.
+func Analyze(tree *peg.Tree) *Analysis {
+	peg.Upgrade(tree)
+	a := &Analysis{
+		Tree:          tree,
+		Start:         tree.RuleList[0].Name,
+		Nullable:      map[string]bool{},
+		First:         map[string]*Set{},
+		Follow:        map[string]*Set{},
+		AltNullable:   map[*peg.ActionExpr]bool{},
+		AltFirst:      map[*peg.ActionExpr]*Set{},
+		Refs:          map[string][]string{},
+		LeftRefs:      map[string][]string{},
+		Reachable:     map[string]bool{},
+		Recursive:     map[string]bool{},
+		LeftRecursive: map[string]bool{},
+		rules:         map[string]*peg.Rule{},
+		skipFirst:     &Set{},
+	}
+	for _, r := range tree.RuleList {
+		a.rules[r.Name] = r
+		a.First[r.Name] = &Set{}
+		a.Follow[r.Name] = &Set{}
+	}
+
+	a.nullable()
+	a.first()
+	a.follow()
+	a.graph()
+
+	return a
+}
+
+// primary returns the primary expression of le.
+func primary(le *peg.LabeledExpr) peg.Expr {
+	return le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr
+}
+
+func (a *Analysis) nullable() {
+	for changed := true; changed; {
+		changed = false
+		for _, r := range a.Tree.RuleList {
+			if !a.Nullable[r.Name] && a.nullableChoice(r.ChoiceExpr) {
+				a.Nullable[r.Name] = true
+				changed = true
+			}
+		}
+	}
+}
+
+func (a *Analysis) nullableChoice(ce *peg.ChoiceExpr) bool {
+	nullable := false
+	for _, ae := range ce.ActionExprs {
+		n := a.nullableSeq(ae.SeqExpr)
+		a.AltNullable[ae] = n
+		nullable = nullable || n
+	}
+	return nullable
+}
+
+func (a *Analysis) nullableSeq(se *peg.SeqExpr) bool {
+	for _, le := range se.LabeledExprs {
+		if !a.nullableItem(le) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Analysis) nullableItem(le *peg.LabeledExpr) bool {
+	if le.PrefixedExpr.PrefixOp != 0 {
+		return true
+	}
+	switch le.PrefixedExpr.SuffixedExpr.SuffixOp {
+	case peg.QUESTION, peg.STAR:
+		return true
+	}
+
+	switch e := primary(le).(type) {
+	case *peg.LitMatcher:
+		return e.Lit == ""
+	case *peg.ClassMatcher, *peg.AnyMatcher, *peg.KindMatcher:
+		return false
+	case *peg.RuleRef:
+		return a.Nullable[e.Name]
+	case *peg.SubExpr:
+		return a.nullableChoice(e.ChoiceExpr)
+	case *peg.RecoverExpr:
+		return a.Nullable[e.Rule]
+	}
+	// predicates, state code, ^ and indentation
+	return true
+}
+
+func (a *Analysis) first() {
+	for changed := true; changed; {
+		changed = false
+		if a.Tree.Skip != nil && a.skipFirst.union(a.firstChoice(a.Tree.Skip, true)) {
+			changed = true
+		}
+		for _, r := range a.Tree.RuleList {
+			if a.First[r.Name].union(a.firstChoice(r.ChoiceExpr, peg.IsLexical(r.Name))) {
+				changed = true
+			}
+		}
+	}
+}
+
+// firstChoice returns FIRST of ce in a lexical or syntactic rule.
+func (a *Analysis) firstChoice(ce *peg.ChoiceExpr, lexical bool) *Set {
+	s := &Set{}
+	for _, ae := range ce.ActionExprs {
+		f := a.firstSeq(ae.SeqExpr.LabeledExprs, lexical)
+		a.AltFirst[ae] = f
+		s.union(f)
+	}
+	return s
+}
+
+func (a *Analysis) firstSeq(les []*peg.LabeledExpr, lexical bool) *Set {
+	s := &Set{}
+	for _, le := range les {
+		if le.PrefixedExpr.PrefixOp == 0 {
+			s.union(a.firstPrimary(primary(le), lexical))
+		}
+		if !a.nullableItem(le) {
+			break
+		}
+	}
+	return s
+}
+
+func (a *Analysis) firstPrimary(pe peg.Expr, lexical bool) *Set {
+	s := &Set{}
+	skip := !lexical && a.Tree.Skip != nil
+
+	switch e := pe.(type) {
+	case *peg.LitMatcher:
+		if peg.TokenInput {
+			s.Texts = []string{e.Lit}
+		} else if e.Lit != "" {
+			c := []rune(e.Lit)[0]
+			s.addRange(c, c)
+		}
+	case *peg.ClassMatcher:
+		s.addCharRange(e.Class)
+	case *peg.KindMatcher:
+		s.Kinds = []string{e.Kind}
+	case *peg.AnyMatcher:
+		s.addAny()
+	case *peg.RuleRef:
+		if f, ok := a.First[e.Name]; ok {
+			s.union(f)
+		}
+		skip = skip && peg.IsLexical(e.Name)
+	case *peg.SubExpr:
+		return a.firstChoice(e.ChoiceExpr, lexical)
+	case *peg.RecoverExpr:
+		if f, ok := a.First[e.Rule]; ok {
+			s.union(f)
+		}
+		skip = false
+	case *peg.IndentExpr:
+		if e.Type != peg.DEDENT {
+			for _, c := range " \t\n\r" {
+				s.addRange(c, c)
+			}
+		}
+		skip = false
+	default:
+		skip = false
+	}
+
+	if skip {
+		s.union(a.skipFirst)
+	}
+	return s
+}
+
+func (a *Analysis) follow() {
+	a.Follow[a.Start].End = true
+
+	all := &Set{End: true}
+	all.addAny()
+
+	for changed := true; changed; {
+		changed = false
+		if a.Tree.Skip != nil && a.followChoice(a.Tree.Skip, all, true) {
+			changed = true
+		}
+		for _, r := range a.Tree.RuleList {
+			if a.followChoice(r.ChoiceExpr, a.Follow[r.Name], peg.IsLexical(r.Name)) {
+				changed = true
+			}
+		}
+	}
+}
+
+// followChoice adds FOLLOW of rules referenced in ce, which is followed by
+// after, and reports whether any changed.
+func (a *Analysis) followChoice(ce *peg.ChoiceExpr, after *Set, lexical bool) bool {
+	changed := false
+	for _, ae := range ce.ActionExprs {
+		les := ae.SeqExpr.LabeledExprs
+		for i, le := range les {
+			// FIRST of the rest of the sequence, and after if it is nullable
+			rest := a.firstSeq(les[i+1:], lexical)
+			if a.nullableSeq(&peg.SeqExpr{LabeledExprs: les[i+1:]}) {
+				rest.union(after)
+			}
+
+			if le.PrefixedExpr.PrefixOp != 0 {
+				rest = &Set{End: true}
+				rest.addAny()
+			}
+			switch le.PrefixedExpr.SuffixedExpr.SuffixOp {
+			case peg.STAR, peg.PLUS:
+				rest.union(a.firstPrimary(primary(le), lexical))
+			}
+
+			switch e := primary(le).(type) {
+			case *peg.RuleRef:
+				if f, ok := a.Follow[e.Name]; ok && f.union(rest) {
+					changed = true
+				}
+			case *peg.RecoverExpr:
+				if f, ok := a.Follow[e.Rule]; ok && f.union(rest) {
+					changed = true
+				}
+			case *peg.SubExpr:
+				if a.followChoice(e.ChoiceExpr, rest, lexical) {
+					changed = true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+func (a *Analysis) graph() {
+	for _, r := range a.Tree.RuleList {
+		a.Refs[r.Name] = a.refs(r.ChoiceExpr, nil, false)
+		a.LeftRefs[r.Name] = a.refs(r.ChoiceExpr, nil, true)
+	}
+
+	// reachability
+	queue := []string{a.Start}
+	if a.Tree.Skip != nil {
+		queue = a.refs(a.Tree.Skip, queue, false)
+	}
+	for _, name := range queue {
+		a.Reachable[name] = true
+	}
+	for len(queue) > 0 {
+		for _, ref := range a.Refs[queue[0]] {
+			if !a.Reachable[ref] {
+				a.Reachable[ref] = true
+				queue = append(queue, ref)
+			}
+		}
+		queue = queue[1:]
+	}
+
+	a.SCCs = a.components(a.Refs)
+	for _, c := range a.SCCs {
+		if len(c) > 1 || contains(a.Refs[c[0]], c[0]) {
+			for _, name := range c {
+				a.Recursive[name] = true
+			}
+		}
+	}
+	for _, c := range a.components(a.LeftRefs) {
+		if len(c) > 1 || contains(a.LeftRefs[c[0]], c[0]) {
+			for _, name := range c {
+				a.LeftRecursive[name] = true
+			}
+		}
+	}
+}
+
+// refs appends rules referenced in ce to refs, or only those referenced
+// before consuming input if left.
+func (a *Analysis) refs(ce *peg.ChoiceExpr, refs []string, left bool) []string {
+	add := func(name string) {
+		if _, ok := a.rules[name]; ok && !contains(refs, name) {
+			refs = append(refs, name)
+		}
+	}
+
+	for _, ae := range ce.ActionExprs {
+		for _, le := range ae.SeqExpr.LabeledExprs {
+			switch e := primary(le).(type) {
+			case *peg.RuleRef:
+				add(e.Name)
+			case *peg.RecoverExpr:
+				add(e.Rule)
+			case *peg.SubExpr:
+				refs = a.refs(e.ChoiceExpr, refs, left)
+			}
+			if left && !a.nullableItem(le) {
+				break
+			}
+		}
+	}
+	return refs
+}
+
+// components returns strongly connected components of graph with Tarjan's
+// algorithm.
+func (a *Analysis) components(graph map[string][]string) [][]string {
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	comps := [][]string{}
+
+	var visit func(name string)
+	visit = func(name string) {
+		index[name] = len(index)
+		low[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+
+		for _, ref := range graph[name] {
+			if _, ok := index[ref]; !ok {
+				visit(ref)
+				if low[ref] < low[name] {
+					low[name] = low[ref]
+				}
+			} else if onStack[ref] && index[ref] < low[name] {
+				low[name] = index[ref]
+			}
+		}
+
+		if low[name] == index[name] {
+			members := map[string]bool{}
+			for {
+				n := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[n] = false
+				members[n] = true
+				if n == name {
+					break
+				}
+			}
+			comp := []string{}
+			for _, r := range a.Tree.RuleList {
+				if members[r.Name] {
+					comp = append(comp, r.Name)
+				}
+			}
+			comps = append(comps, comp)
+		}
+	}
+
+	for _, r := range a.Tree.RuleList {
+		if _, ok := index[r.Name]; !ok {
+			visit(r.Name)
+		}
+	}
+	return comps
+}
+
+func contains(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
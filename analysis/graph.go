@@ -0,0 +1,124 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// sccIndex returns the index in SCCs of the component of each rule.
+func (a *Analysis) sccIndex() map[string]int {
+	index := map[string]int{}
+	for i, c := range a.SCCs {
+		for _, name := range c {
+			index[name] = i
+		}
+	}
+	return index
+}
+
+// WriteDOT writes the graph of references between rules in Graphviz DOT. The
+// start rule has a double border, unreachable rules are gray and dashed, and
+// left recursive rules and references in recursive cycles are red.
+// %skip is a note referencing its rules.
+func (a *Analysis) WriteDOT(out io.Writer) {
+	scc := a.sccIndex()
+
+	fmt.Fprintln(out, "digraph grammar {")
+	fmt.Fprintln(out, "\tnode [shape=box];")
+
+	for _, r := range a.Tree.RuleList {
+		attrs := []string{}
+		switch {
+		case r.Name == a.Start:
+			attrs = append(attrs, "peripheries=2", "style=bold")
+		case !a.Reachable[r.Name]:
+			attrs = append(attrs, "style=dashed")
+		}
+		switch {
+		case a.LeftRecursive[r.Name]:
+			attrs = append(attrs, "color=red", "fontcolor=red")
+		case !a.Reachable[r.Name]:
+			attrs = append(attrs, "color=gray", "fontcolor=gray")
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(out, "\t%s [%s];\n", strconv.Quote(r.Name), strings.Join(attrs, ", "))
+		} else {
+			fmt.Fprintf(out, "\t%s;\n", strconv.Quote(r.Name))
+		}
+	}
+
+	if a.Tree.Skip != nil {
+		io.WriteString(out, "\t\"%skip\" [shape=note];\n")
+		for _, ref := range a.refs(a.Tree.Skip, nil, false) {
+			fmt.Fprintf(out, "\t\"%%skip\" -> %s [style=dashed];\n", strconv.Quote(ref))
+		}
+	}
+
+	for _, r := range a.Tree.RuleList {
+		for _, ref := range a.Refs[r.Name] {
+			if scc[ref] == scc[r.Name] {
+				fmt.Fprintf(out, "\t%s -> %s [color=red];\n", strconv.Quote(r.Name), strconv.Quote(ref))
+			} else {
+				fmt.Fprintf(out, "\t%s -> %s;\n", strconv.Quote(r.Name), strconv.Quote(ref))
+			}
+		}
+	}
+
+	fmt.Fprintln(out, "}")
+}
+
+type jsonGraph struct {
+	Start string      `json:"start"`
+	Skip  []string    `json:"skip,omitempty"`
+	Rules []*jsonRule `json:"rules"`
+	SCCs  [][]string  `json:"sccs"`
+}
+
+type jsonRule struct {
+	Name          string   `json:"name"`
+	Refs          []string `json:"refs"`
+	Reachable     bool     `json:"reachable"`
+	Recursive     bool     `json:"recursive"`
+	LeftRecursive bool     `json:"leftRecursive"`
+	SCC           int      `json:"scc"` // index in sccs
+}
+
+// WriteJSON writes the graph of references between rules in JSON, as an
+// object with the start rule, rules referenced by %skip, the rules with their
+// references, and strongly connected components in reverse topological order.
+func (a *Analysis) WriteJSON(out io.Writer) error {
+	scc := a.sccIndex()
+
+	g := &jsonGraph{
+		Start: a.Start,
+		Rules: []*jsonRule{},
+		SCCs:  a.SCCs,
+	}
+	if a.Tree.Skip != nil {
+		g.Skip = a.refs(a.Tree.Skip, nil, false)
+	}
+	for _, r := range a.Tree.RuleList {
+		refs := a.Refs[r.Name]
+		if refs == nil {
+			refs = []string{}
+		}
+		g.Rules = append(g.Rules, &jsonRule{
+			Name:          r.Name,
+			Refs:          refs,
+			Reachable:     a.Reachable[r.Name],
+			Recursive:     a.Recursive[r.Name],
+			LeftRecursive: a.LeftRecursive[r.Name],
+			SCC:           scc[r.Name],
+		})
+	}
+
+	b, err := json.MarshalIndent(g, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(b, '\n'))
+	return err
+}
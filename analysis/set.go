@@ -0,0 +1,166 @@
+package analysis
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+// Set is a set of characters, or of tokens with peg.TokenInput, which can
+// start or follow an expression.
+type Set struct {
+	Chars    []peg.Char // disjoint ranges of characters, in order
+	AnyToken bool       // any token, with peg.TokenInput
+	Kinds    []string   // kinds of tokens, sorted
+	Texts    []string   // texts of tokens, sorted
+	End      bool       // end of input, in FOLLOW sets
+}
+
+// Contains reports whether c is in s.
+func (s *Set) Contains(c rune) bool {
+	i := sort.Search(len(s.Chars), func(i int) bool {
+		return s.Chars[i].End >= c
+	})
+	return i < len(s.Chars) && s.Chars[i].Start <= c
+}
+
+// ContainsToken reports whether a token of kind and text is in s.
+func (s *Set) ContainsToken(kind, text string) bool {
+	return s.AnyToken || hasString(s.Kinds, kind) || hasString(s.Texts, text)
+}
+
+// Empty reports whether s has no characters, tokens or end of input.
+func (s *Set) Empty() bool {
+	return len(s.Chars) == 0 && !s.AnyToken && len(s.Kinds) == 0 && len(s.Texts) == 0 && !s.End
+}
+
+// String returns s like a character class, or . for all characters, followed
+// by tokens and $ for end of input, as in [+\-0-9] @NUMBER "if" $.
+func (s *Set) String() string {
+	parts := []string{}
+	if len(s.Chars) == 1 && s.Chars[0].Start == 0 && s.Chars[0].End == unicode.MaxRune {
+		parts = append(parts, ".")
+	} else if len(s.Chars) > 0 {
+		buf := "["
+		for _, c := range s.Chars {
+			buf += classChar(c.Start)
+			if c.End != c.Start {
+				buf += "-" + classChar(c.End)
+			}
+		}
+		parts = append(parts, buf+"]")
+	}
+	if s.AnyToken {
+		parts = append(parts, ".")
+	}
+	for _, k := range s.Kinds {
+		parts = append(parts, "@"+k)
+	}
+	for _, t := range s.Texts {
+		parts = append(parts, strconv.Quote(t))
+	}
+	if s.End {
+		parts = append(parts, "$")
+	}
+	return strings.Join(parts, " ")
+}
+
+// classChar returns c escaped in a character class.
+func classChar(c rune) string {
+	switch {
+	case c == ']' || c == '\\' || c == '-' || c == '^':
+		return "\\" + string(c)
+	case !unicode.IsPrint(c):
+		q := strconv.QuoteRune(c)
+		return q[1 : len(q)-1]
+	}
+	return string(c)
+}
+
+func (s *Set) addRange(start, end rune) {
+	s.Chars = append(s.Chars, peg.Char{Start: start, End: end})
+	sort.Slice(s.Chars, func(i, j int) bool {
+		return s.Chars[i].Start < s.Chars[j].Start
+	})
+
+	// merge overlapping and adjacent ranges
+	merged := s.Chars[:1]
+	for _, c := range s.Chars[1:] {
+		last := &merged[len(merged)-1]
+		if c.Start <= last.End+1 {
+			if c.End > last.End {
+				last.End = c.End
+			}
+		} else {
+			merged = append(merged, c)
+		}
+	}
+	s.Chars = merged
+}
+
+func (s *Set) addAny() {
+	if peg.TokenInput {
+		s.AnyToken = true
+	} else {
+		s.addRange(0, unicode.MaxRune)
+	}
+}
+
+func (s *Set) addCharRange(cr *peg.CharRange) {
+	if !cr.Not {
+		for _, c := range cr.Chars {
+			s.addRange(c.Start, c.End)
+		}
+		return
+	}
+
+	// complement of the class
+	not := &Set{}
+	not.addCharRange(&peg.CharRange{Chars: cr.Chars})
+	next := rune(0)
+	for _, c := range not.Chars {
+		if c.Start > next {
+			s.addRange(next, c.Start-1)
+		}
+		next = c.End + 1
+	}
+	if next <= unicode.MaxRune {
+		s.addRange(next, unicode.MaxRune)
+	}
+}
+
+// union adds o to s, and reports whether s changed.
+func (s *Set) union(o *Set) bool {
+	before := s.String()
+	for _, c := range o.Chars {
+		s.addRange(c.Start, c.End)
+	}
+	s.AnyToken = s.AnyToken || o.AnyToken
+	for _, k := range o.Kinds {
+		s.Kinds = addString(s.Kinds, k)
+	}
+	for _, t := range o.Texts {
+		s.Texts = addString(s.Texts, t)
+	}
+	s.End = s.End || o.End
+	return s.String() != before
+}
+
+func hasString(a []string, s string) bool {
+	i := sort.SearchStrings(a, s)
+	return i < len(a) && a[i] == s
+}
+
+func addString(a []string, s string) []string {
+	i := sort.SearchStrings(a, s)
+	if i < len(a) && a[i] == s {
+		return a
+	}
+	a = append(a, "")
+	copy(a[i+1:], a[i:])
+	a[i] = s
+	return a
+}
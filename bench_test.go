@@ -0,0 +1,116 @@
+package peg_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+	"github.com/laurence6/PEG.go/internal/gentest"
+)
+
+// readGrammar reads and checks the grammar file name.
+func readGrammar(tb testing.TB, name string) *peg.Tree {
+	tb.Helper()
+
+	f, err := os.Open(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+
+	tree, err := peg.ReadTree(f)
+	if err != nil {
+		tb.Fatalf("%s: %v", name, err)
+	}
+	return tree
+}
+
+// benchMain measures Parse of the file given as argument with
+// testing.Benchmark, and prints ns/op, allocs/op and B/op.
+const benchMain = `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gentest/parser"
+)
+
+func main() {
+	src, err := ioutil.ReadFile(os.Args[1])
+	if err != nil {
+		panic(err)
+	}
+	in := []rune(string(src))
+	if _, err := parser.Parse(in); err != nil {
+		panic(err)
+	}
+
+	r := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			parser.Parse(in)
+		}
+	})
+	fmt.Println(r.NsPerOp(), r.AllocsPerOp(), r.AllocedBytesPerOp())
+}
+`
+
+// BenchmarkJSON measures parsers generated from testdata/json.peg with each
+// backend on testdata/bench.json, and the baseline in
+// testdata/json_before_matchers.go, generated before matchers. The parsers
+// are measured by a command built in a temporary module, whose results are
+// reported as those of the benchmark.
+func BenchmarkJSON(b *testing.B) {
+	input, err := filepath.Abs("testdata/bench.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, backend := range []struct {
+		name   string
+		vm     bool
+		source string // generated parser, instead of generating one
+	}{
+		{"Closure", false, ""},
+		{"ClosureBeforeMatchers", false, "testdata/json_before_matchers.go"},
+		{"VM", true, ""},
+	} {
+		var results []float64
+		b.Run(backend.name, func(b *testing.B) {
+			if results == nil {
+				var bin string
+				if backend.source != "" {
+					src, err := ioutil.ReadFile(backend.source)
+					if err != nil {
+						b.Fatal(err)
+					}
+					bin = gentest.BuildSource(b, string(src), benchMain)
+				} else {
+					peg.VMBackend = backend.vm
+					defer func() { peg.VMBackend = false }()
+					bin = gentest.Build(b, readGrammar(b, "testdata/json.peg"), benchMain)
+				}
+
+				out, err := exec.Command(bin, input).Output()
+				if err != nil {
+					b.Fatal(err)
+				}
+				results = make([]float64, 3)
+				if _, err := fmt.Sscan(string(out), &results[0], &results[1], &results[2]); err != nil {
+					b.Fatalf("%v: %q", err, out)
+				}
+			}
+
+			b.ReportMetric(results[0], "ns/op")
+			b.ReportMetric(results[1], "allocs/op")
+			b.ReportMetric(results[2], "B/op")
+		})
+	}
+}
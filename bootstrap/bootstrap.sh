@@ -0,0 +1,23 @@
+#!/bin/sh
+# Generates bootstrap/peg.go from bootstrap/peg.peg with the hand-written
+# parser, then checks that the generated parser generates the same code as
+# the hand-written one for peg.peg, itself and grammars given as arguments.
+set -e
+
+cd "$(dirname "$0")/.."
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+go run ./bootstrap/stage0 < bootstrap/peg.peg > "$tmp/peg.go"
+mv "$tmp/peg.go" bootstrap/peg.go
+
+for g in bootstrap/peg.peg "$@"; do
+	go run ./bootstrap/stage0 < "$g" > "$tmp/stage0.go"
+	go run ./bootstrap < "$g" > "$tmp/stage1.go"
+	if ! cmp -s "$tmp/stage0.go" "$tmp/stage1.go"; then
+		echo "$g: generated parsers differ" >&2
+		diff "$tmp/stage0.go" "$tmp/stage1.go" >&2 || true
+		exit 1
+	fi
+done
@@ -0,0 +1,13 @@
+// Command stage0 generates a parser from a grammar on stdin with the
+// hand-written parser of PEG.go. See "Bootstrapping" in README.md.
+package main
+
+import (
+	"os"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+func main() {
+	peg.GenerateParser(os.Stdin, os.Stdout)
+}
@@ -0,0 +1,102 @@
+package peg_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+	"github.com/laurence6/PEG.go/internal/gentest"
+)
+
+// treeMain reads each grammar file given as argument with ReadTree and with
+// the parser generated from bootstrap/peg.peg, and prints the parts of the
+// trees which differ.
+const treeMain = `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	peg "github.com/laurence6/PEG.go"
+	"gentest/parser"
+)
+
+// clearPos clears positions, which only ReadTree sets.
+func clearPos(tree *peg.Tree) {
+	peg.Inspect(tree, func(n peg.Node) bool {
+		switch n := n.(type) {
+		case *peg.Rule:
+			n.Pos, n.End = peg.Pos{}, peg.Pos{}
+		case *peg.ActionExpr:
+			n.Pos, n.End = peg.Pos{}, peg.Pos{}
+		case *peg.SuffixedExpr:
+			n.Pos, n.End = peg.Pos{}, peg.Pos{}
+		}
+		return true
+	})
+}
+
+func main() {
+	for _, name := range os.Args[1:] {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			panic(err)
+		}
+		want, err := peg.ReadTree(strings.NewReader(string(src)))
+		if err != nil {
+			fmt.Printf("%s: ReadTree: %v\n", name, err)
+			continue
+		}
+		v, err := parser.Parse([]rune(string(src)))
+		if err != nil {
+			fmt.Printf("%s: Parse: %v\n", name, err)
+			continue
+		}
+		got := v.(*peg.Tree)
+		clearPos(want)
+		clearPos(got)
+
+		g, w := *got.Grammar, *want.Grammar
+		g.RuleList, w.RuleList = nil, nil
+		if !reflect.DeepEqual(g, w) {
+			fmt.Printf("%s: grammars differ\n", name)
+		}
+		if len(got.RuleList) != len(want.RuleList) {
+			fmt.Printf("%s: %d rules, want %d\n", name, len(got.RuleList), len(want.RuleList))
+			continue
+		}
+		for i, r := range want.RuleList {
+			if !reflect.DeepEqual(got.RuleList[i], r) {
+				fmt.Printf("%s: rule %s differs\n", name, r.Name)
+			}
+		}
+	}
+}
+`
+
+// TestBootstrap checks that the parser generated from bootstrap/peg.peg
+// returns the same Trees as ReadTree for sample grammars.
+func TestBootstrap(t *testing.T) {
+	tree := readGrammar(t, "bootstrap/peg.peg")
+	// used by the main function, which is not generated in package parser
+	imports := []*peg.Import{}
+	for _, i := range tree.Import {
+		if i.Path != "io/ioutil" && i.Path != "os" {
+			imports = append(imports, i)
+		}
+	}
+	tree.Import = imports
+
+	bin := gentest.Build(t, tree, treeMain)
+	out, err := exec.Command(bin, "bootstrap/peg.peg", "testdata/json.peg", "testdata/outline.peg").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := strings.TrimSpace(string(out)); diff != "" {
+		t.Error(diff)
+	}
+}
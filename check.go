@@ -21,41 +21,96 @@ var checkers = [...]func(*Tree) []error{
 		}
 
 		// Rule undefined
-		stack := []*ChoiceExpr{}
+		undefined := func(rn string) {
+			if _, ok := rs[rn]; !ok {
+				errs = append(errs, errors.New(
+					fmt.Sprintf("Rule %q undefined", rn),
+				))
+			}
+		}
 
-		checkCE := func(ce *ChoiceExpr) {
-			for _, ae := range ce.ActionExprs {
-				for _, le := range ae.SeqExpr.LabeledExprs {
-					pe := le.PrefixedExpr.SuffixedExpr.PrimaryExpr.PrimaryExpr
-					switch pe.(type) {
-					case string:
-						rn := pe.(string)
-						if _, ok := rs[rn]; !ok {
-							errs = append(errs, errors.New(
-								fmt.Sprintf("Rule %q undefined", rn),
-							))
-						}
-					case *ChoiceExpr:
-						stack = append(stack, pe.(*ChoiceExpr))
+		Inspect(tree, func(n Node) bool {
+			switch n := n.(type) {
+			case *PrimaryExpr:
+				if rn, ok := n.RuleRef(); ok {
+					undefined(rn)
+				}
+			case *RecoverExpr:
+				undefined(n.Rule)
+			case *PrefixedExpr:
+				if _, ok := n.SuffixedExpr.PrimaryExpr.Expr.(*StateCodeExpr); ok {
+					if tree.State == "" {
+						errs = append(errs, errors.New("%{ } without %state"))
+					}
+					if n.PrefixOp != 0 || n.SuffixedExpr.SuffixOp != 0 {
+						errs = append(errs, errors.New("%{ } with operator"))
+					}
+				}
+				if t, ok := n.SuffixedExpr.PrimaryExpr.Expr.(*ThrowExpr); ok {
+					// ^"msg"* would match nothing forever
+					if n.PrefixOp != 0 || n.SuffixedExpr.SuffixOp != 0 {
+						errs = append(errs, errors.New(
+							fmt.Sprintf("^%q with operator", t.Msg),
+						))
 					}
 				}
 			}
-		}
+			return true
+		})
 
-		for _, r := range tree.RuleList {
-			stack = append(stack, r.ChoiceExpr)
-		}
+		return
+	},
 
-		for len(stack) > 0 {
-			checkCE(stack[0])
-			stack = stack[1:]
+	func(tree *Tree) (errs []error) {
+		if tree.Skip == nil {
+			return
 		}
 
+		// Syntactic rule in %skip, which would skip recursively
+		Inspect(tree.Skip, func(n Node) bool {
+			if pe, ok := n.(*PrimaryExpr); ok {
+				if rn, ok := pe.RuleRef(); ok && !IsLexical(rn) {
+					errs = append(errs, errors.New(
+						fmt.Sprintf("Syntactic rule %q in %%skip", rn),
+					))
+				}
+			}
+			return true
+		})
+
+		return
+	},
+
+	func(tree *Tree) (errs []error) {
+		// Matchers of the other input mode
+		Inspect(tree, func(n Node) bool {
+			switch n := n.(type) {
+			case *ClassMatcher:
+				if TokenInput {
+					errs = append(errs, errors.New("Character class with token input"))
+				}
+			case *KindMatcher:
+				if !TokenInput {
+					errs = append(errs, errors.New(
+						fmt.Sprintf("Token kind @%s without token input", n.Kind),
+					))
+				}
+			case *IndentExpr:
+				if TokenInput {
+					errs = append(errs, errors.New(
+						fmt.Sprintf("%v with token input", n.Type),
+					))
+				}
+			}
+			return true
+		})
+
 		return
 	},
 }
 
 func Check(tree *Tree) []error {
+	Upgrade(tree)
 	errs := []error{}
 
 	for _, checker := range checkers {
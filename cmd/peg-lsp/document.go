@@ -0,0 +1,537 @@
+package main
+
+import (
+	"fmt"
+	goscanner "go/scanner"
+	gotoken "go/token"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+// document is an open grammar file with its tokens indexed.
+type document struct {
+	uri    string
+	text   string
+	lines  [][]rune // without line endings
+	tokens []peg.Token
+	ok     bool // tokens are complete
+
+	rules  []*rule
+	refs   []int // indexes of tokens referring to rules
+	labels []*label
+	diags  []Diagnostic
+}
+
+type rule struct {
+	name string
+	def  int // index of the name token
+	end  int // index of the first token after the rule
+}
+
+type label struct {
+	name string
+	def  int // index of the name token
+	end  int // index of the first token after the sequence
+}
+
+// codeIdent is an identifier in Go code of a CODE or STATECODE token.
+type codeIdent struct {
+	name string
+	pos  peg.Pos
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, text: text}
+	for _, line := range strings.Split(text, "\n") {
+		d.lines = append(d.lines, []rune(strings.TrimSuffix(line, "\r")))
+	}
+
+	var err error
+	d.tokens, err = scan(text)
+	d.index()
+	if err != nil {
+		d.addError(err.Error())
+	} else {
+		d.ok = true
+		d.check()
+	}
+
+	return d
+}
+
+func scan(text string) (tokens []peg.Token, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	s := peg.NewScanner(strings.NewReader(text), peg.BufferSize)
+	for {
+		t := s.Scan()
+		tokens = append(tokens, t)
+		if t.Type == peg.EOF {
+			return
+		}
+	}
+}
+
+// check parses tokens and checks the tree, adding diagnostics.
+func (d *document) check() {
+	tree, err := getTree(d.tokens)
+	if err != nil {
+		d.addError(err.Error())
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, err := range peg.Check(tree) {
+		msg := err.Error()
+		if seen[msg] {
+			continue
+		}
+		seen[msg] = true
+		d.addCheckError(msg)
+	}
+}
+
+func getTree(tokens []peg.Token) (tree *peg.Tree, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	ptrs := make([]*peg.Token, len(tokens))
+	for i := range tokens {
+		ptrs[i] = &tokens[i]
+	}
+	return peg.GetTree(ptrs), nil
+}
+
+var errorPos = regexp.MustCompile(`^(\d+):(\d+):? (.*)$`)
+
+// addError adds an error of the scanner or the parser, which starts with
+// its position.
+func (d *document) addError(msg string) {
+	pos := peg.Pos{Line: 1, Col: 1}
+	if m := errorPos.FindStringSubmatch(msg); m != nil {
+		pos.Line, _ = strconv.Atoi(m[1])
+		pos.Col, _ = strconv.Atoi(m[2])
+		msg = m[3]
+		// drop the function name of the parser
+		if i := strings.Index(msg, " expect "); i >= 0 {
+			msg = msg[i+1:]
+		}
+	}
+	d.diags = append(d.diags, d.diagnostic(d.rangeOf(pos, 1), msg))
+}
+
+var quotedName = regexp.MustCompile(`"([^"]*)"`)
+
+// addCheckError adds an error of Check at rules it names, or at the start
+// of the document.
+func (d *document) addCheckError(msg string) {
+	ranges := []Range{}
+	if m := quotedName.FindStringSubmatch(msg); m != nil {
+		name := m[1]
+		if strings.HasPrefix(msg, "Dup rule") {
+			for _, r := range d.rulesNamed(name)[1:] {
+				ranges = append(ranges, d.tokenRange(r.def))
+			}
+		} else {
+			for _, i := range d.refs {
+				if string(d.tokens[i].Literal) == name {
+					ranges = append(ranges, d.tokenRange(i))
+				}
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		ranges = append(ranges, d.rangeOf(peg.Pos{Line: 1, Col: 1}, 0))
+	}
+	for _, r := range ranges {
+		d.diags = append(d.diags, d.diagnostic(r, msg))
+	}
+}
+
+func (d *document) diagnostic(r Range, msg string) Diagnostic {
+	return Diagnostic{Range: r, Severity: severityError, Source: "peg", Message: msg}
+}
+
+// indentKeywords match indentation in grammars not defining rules of the names.
+var indentKeywords = map[string]bool{"INDENT": true, "DEDENT": true, "SAMEDENT": true}
+
+// index finds rules, labels and references to rules in tokens.
+func (d *document) index() {
+	typeAt := func(i int) peg.TokenType {
+		if i < 0 || i >= len(d.tokens) {
+			return peg.NONE
+		}
+		return d.tokens[i].Type
+	}
+
+	for i, t := range d.tokens {
+		if t.Type != peg.IDENT {
+			continue
+		}
+		switch {
+		case typeAt(i-1) == peg.PACKAGE || typeAt(i-1) == peg.IMPORT:
+			// package name or import name
+		case typeAt(i+1) == peg.ASSIGN:
+			if len(d.rules) > 0 {
+				d.rules[len(d.rules)-1].end = i
+			}
+			d.rules = append(d.rules, &rule{name: string(t.Literal), def: i, end: len(d.tokens)})
+		case typeAt(i+1) == peg.COLON:
+			d.labels = append(d.labels, &label{name: string(t.Literal), def: i})
+		default:
+			d.refs = append(d.refs, i)
+		}
+	}
+
+	// INDENT, DEDENT and SAMEDENT refer to rules only if defined
+	refs := []int{}
+	for _, i := range d.refs {
+		name := string(d.tokens[i].Literal)
+		if !indentKeywords[name] || len(d.rulesNamed(name)) > 0 {
+			refs = append(refs, i)
+		}
+	}
+	d.refs = refs
+
+	for _, l := range d.labels {
+		l.end = d.sequenceEnd(l.def)
+	}
+}
+
+// sequenceEnd returns the index of the first token after the sequence
+// containing token i, including its action.
+func (d *document) sequenceEnd(i int) int {
+	end := len(d.tokens)
+	if r := d.ruleOf(i); r != nil {
+		end = r.end
+	}
+
+	depth := 0
+	for ; i < end; i++ {
+		switch d.tokens[i].Type {
+		case peg.LPAREN:
+			depth++
+		case peg.RPAREN:
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case peg.SLASH:
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return end
+}
+
+// ruleOf returns the rule containing token i.
+func (d *document) ruleOf(i int) *rule {
+	for _, r := range d.rules {
+		if r.def <= i && i < r.end {
+			return r
+		}
+	}
+	return nil
+}
+
+func (d *document) rulesNamed(name string) []*rule {
+	rules := []*rule{}
+	for _, r := range d.rules {
+		if r.name == name {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// codeIdents returns identifiers in Go code of token i, except selectors.
+func (d *document) codeIdents(i int) []codeIdent {
+	t := d.tokens[i]
+	start := t.Pos
+	switch t.Type {
+	case peg.CODE:
+		start.Col += 1 // {
+	case peg.STATECODE:
+		start.Col += 2 // %{
+	default:
+		return nil
+	}
+
+	code := string(t.Literal)
+	fset := gotoken.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(code))
+	var s goscanner.Scanner
+	s.Init(file, []byte(code), nil, 0)
+
+	idents := []codeIdent{}
+	prev := gotoken.ILLEGAL
+	for {
+		p, tok, lit := s.Scan()
+		if tok == gotoken.EOF {
+			break
+		}
+		if tok == gotoken.IDENT && prev != gotoken.PERIOD {
+			idents = append(idents, codeIdent{lit, advance(start, code[:file.Offset(p)])})
+		}
+		prev = tok
+	}
+	return idents
+}
+
+// advance returns the position after text starting at pos.
+func advance(pos peg.Pos, text string) peg.Pos {
+	for _, c := range text {
+		if c == '\n' {
+			pos.Line++
+			pos.Col = 1
+		} else if c != '\r' {
+			pos.Col++
+		}
+	}
+	return pos
+}
+
+// tokenAt returns the index of the token at pos, or -1.
+func (d *document) tokenAt(pos peg.Pos) int {
+	for i, t := range d.tokens {
+		if t.Pos.Line > pos.Line || t.Pos.Line == pos.Line && t.Pos.Col > pos.Col {
+			return i - 1
+		}
+	}
+	return len(d.tokens) - 1
+}
+
+// symbol is a rule or a label under the cursor.
+type symbol struct {
+	rule  string
+	label *label
+	r     Range
+}
+
+func (d *document) symbolAt(pos peg.Pos) *symbol {
+	i := d.tokenAt(pos)
+	if i < 0 {
+		return nil
+	}
+	t := d.tokens[i]
+
+	if t.Type == peg.IDENT {
+		if pos.Line != t.Pos.Line || pos.Col > t.Pos.Col+len(t.Literal) {
+			return nil
+		}
+		for _, l := range d.labels {
+			if l.def == i {
+				return &symbol{label: l, r: d.tokenRange(i)}
+			}
+		}
+		for _, r := range d.rules {
+			if r.def == i {
+				return &symbol{rule: r.name, r: d.tokenRange(i)}
+			}
+		}
+		for _, ref := range d.refs {
+			if ref == i {
+				return &symbol{rule: string(t.Literal), r: d.tokenRange(i)}
+			}
+		}
+		return nil
+	}
+
+	for _, id := range d.codeIdents(i) {
+		if id.pos.Line != pos.Line || pos.Col < id.pos.Col || pos.Col > id.pos.Col+len([]rune(id.name)) {
+			continue
+		}
+		// the nearest label in scope
+		var found *label
+		for _, l := range d.labels {
+			if l.name == id.name && l.def < i && i < l.end {
+				found = l
+			}
+		}
+		if found != nil {
+			return &symbol{label: found, r: d.rangeOf(id.pos, len([]rune(id.name)))}
+		}
+	}
+	return nil
+}
+
+// ruleRanges returns ranges of references to rule name, and of its
+// definitions if decl.
+func (d *document) ruleRanges(name string, decl bool) []Range {
+	ranges := []Range{}
+	if decl {
+		for _, r := range d.rulesNamed(name) {
+			ranges = append(ranges, d.tokenRange(r.def))
+		}
+	}
+	for _, i := range d.refs {
+		if string(d.tokens[i].Literal) == name {
+			ranges = append(ranges, d.tokenRange(i))
+		}
+	}
+	return ranges
+}
+
+// labelRanges returns ranges of l and its uses in code of the sequence.
+func (d *document) labelRanges(l *label) []Range {
+	ranges := []Range{d.tokenRange(l.def)}
+	for i := l.def + 1; i < l.end; i++ {
+		for _, id := range d.codeIdents(i) {
+			if id.name == l.name && d.labelOf(id.name, i) == l {
+				ranges = append(ranges, d.rangeOf(id.pos, len([]rune(id.name))))
+			}
+		}
+	}
+	return ranges
+}
+
+// labelOf returns the label name used by code of token i.
+func (d *document) labelOf(name string, i int) *label {
+	var found *label
+	for _, l := range d.labels {
+		if l.name == name && l.def < i && i < l.end {
+			found = l
+		}
+	}
+	return found
+}
+
+// ruleText returns the source of rule r without trailing comments.
+func (d *document) ruleText(r *rule) string {
+	start := d.tokens[r.def].Pos
+	endLine := len(d.lines)
+	if r.end < len(d.tokens) && d.tokens[r.end].Type != peg.EOF {
+		endLine = d.tokens[r.end].Pos.Line - 1
+	}
+
+	lines := []string{}
+	for n := start.Line; n <= endLine && n <= len(d.lines); n++ {
+		line := d.lines[n-1]
+		if n == start.Line {
+			line = line[start.Col-1:]
+		}
+		lines = append(lines, strings.TrimRight(string(line), " \t"))
+	}
+	for len(lines) > 1 {
+		last := strings.TrimSpace(lines[len(lines)-1])
+		if last != "" && !strings.HasPrefix(last, "#") {
+			break
+		}
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (d *document) tokenRange(i int) Range {
+	t := d.tokens[i]
+	return d.rangeOf(t.Pos, len(t.Literal))
+}
+
+// rangeOf returns the range of n characters at pos in a line.
+func (d *document) rangeOf(pos peg.Pos, n int) Range {
+	end := pos
+	end.Col += n
+	return Range{d.position(pos), d.position(end)}
+}
+
+// position converts pos of the scanner to a position of LSP.
+func (d *document) position(pos peg.Pos) Position {
+	p := Position{Line: pos.Line - 1}
+	if p.Line < 0 {
+		return Position{}
+	}
+	if p.Line >= len(d.lines) {
+		return p
+	}
+	line := d.lines[p.Line]
+	col := pos.Col - 1
+	if col > len(line) {
+		col = len(line)
+	}
+	if col > 0 {
+		p.Character = len(utf16.Encode(line[:col]))
+	}
+	return p
+}
+
+// pos converts a position of LSP to a position of the scanner.
+func (d *document) pos(p Position) peg.Pos {
+	pos := peg.Pos{Line: p.Line + 1, Col: 1}
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return pos
+	}
+	units := 0
+	for _, c := range d.lines[p.Line] {
+		if units >= p.Character {
+			break
+		}
+		units += len(utf16.Encode([]rune{c}))
+		pos.Col++
+	}
+	return pos
+}
+
+// end returns the position at the end of the document.
+func (d *document) end() Position {
+	n := len(d.lines)
+	return d.position(peg.Pos{Line: n, Col: len(d.lines[n-1]) + 1})
+}
+
+// format returns the text with trailing spaces and repeated blank lines
+// removed, and alternatives starting lines indented with a tab. Lines of
+// multi-line code are kept.
+func (d *document) format() string {
+	raw := strings.Split(d.text, "\n")
+
+	kept := make([]bool, len(raw))
+	for _, t := range d.tokens {
+		if t.Type != peg.CODE && t.Type != peg.STATECODE {
+			continue
+		}
+		if n := strings.Count(string(t.Literal), "\n"); n > 0 {
+			for l := t.Pos.Line - 1; l <= t.Pos.Line-1+n && l < len(raw); l++ {
+				kept[l] = true
+			}
+		}
+	}
+
+	out := []string{}
+	blank := false
+	for i, line := range raw {
+		if kept[i] {
+			if blank {
+				out = append(out, "")
+				blank = false
+			}
+			out = append(out, line)
+			continue
+		}
+
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank = len(out) > 0
+			continue
+		}
+		if blank {
+			out = append(out, "")
+			blank = false
+		}
+		if trimmed := strings.TrimLeft(line, " \t"); strings.HasPrefix(trimmed, "/") {
+			line = "\t" + trimmed
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n") + "\n"
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"go/token"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+type server struct {
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+func newServer(out io.Writer) *server {
+	return &server{out: out, docs: map[string]*document{}}
+}
+
+// serve handles messages from in until the exit notification or EOF.
+func (s *server) serve(in io.Reader) error {
+	r := bufio.NewReader(in)
+	for {
+		body, err := readMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		msg := message{}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.reply(nil, nil, &responseError{codeParseError, err.Error()})
+			continue
+		}
+
+		result, err := s.handle(&msg)
+		if err == errExit {
+			return nil
+		}
+		if msg.ID == nil {
+			if err != nil {
+				log.Printf("%s: %v", msg.Method, err)
+			}
+			continue
+		}
+		s.reply(msg.ID, result, err)
+	}
+}
+
+func (s *server) reply(id *json.RawMessage, result interface{}, err error) {
+	resp := response{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		e, ok := err.(*responseError)
+		if !ok {
+			e = &responseError{codeInternalError, err.Error()}
+		}
+		resp.Error = e
+	} else {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &responseError{codeInternalError, err.Error()}
+		} else {
+			r := json.RawMessage(raw)
+			resp.Result = &r
+		}
+	}
+	if err := writeMessage(s.out, resp); err != nil {
+		log.Print(err)
+	}
+}
+
+func (s *server) notify(method string, params interface{}) {
+	if err := writeMessage(s.out, notification{"2.0", method, params}); err != nil {
+		log.Print(err)
+	}
+}
+
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+func (s *server) handle(msg *message) (interface{}, error) {
+	if s.shutdown && msg.Method != "exit" {
+		return nil, &responseError{codeInvalidRequest, "server is shut down"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return s.initialize()
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "exit":
+		return nil, errExit
+
+	case "textDocument/didOpen":
+		p := DidOpenTextDocumentParams{}
+		if err := decode(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		s.open(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		p := DidChangeTextDocumentParams{}
+		if err := decode(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.open(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		p := DidCloseTextDocumentParams{}
+		if err := decode(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{p.TextDocument.URI, []Diagnostic{}})
+		return nil, nil
+
+	case "textDocument/definition":
+		p := TextDocumentPositionParams{}
+		if err := decode(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.definition(p)
+	case "textDocument/references":
+		p := ReferenceParams{}
+		if err := decode(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.references(p)
+	case "textDocument/hover":
+		p := TextDocumentPositionParams{}
+		if err := decode(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.hover(p)
+	case "textDocument/rename":
+		p := RenameParams{}
+		if err := decode(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.rename(p)
+	case "textDocument/documentSymbol":
+		p := DocumentParams{}
+		if err := decode(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.symbols(p)
+	case "textDocument/formatting":
+		p := DocumentParams{}
+		if err := decode(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.format(p)
+	}
+
+	return nil, &responseError{codeMethodNotFound, "method not found: " + msg.Method}
+}
+
+func (s *server) initialize() (interface{}, error) {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":           1, // full
+			"definitionProvider":         true,
+			"referencesProvider":         true,
+			"hoverProvider":              true,
+			"renameProvider":             true,
+			"documentSymbolProvider":     true,
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]string{"name": "peg-lsp"},
+	}, nil
+}
+
+func (s *server) open(uri, text string) {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+	diags := d.diags
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{uri, diags})
+}
+
+func (s *server) document(uri string) (*document, error) {
+	d, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{codeInvalidParams, "unknown document " + uri}
+	}
+	return d, nil
+}
+
+func (s *server) definition(p TextDocumentPositionParams) (interface{}, error) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	sym := d.symbolAt(d.pos(p.Position))
+	if sym == nil {
+		return nil, nil
+	}
+	locs := []Location{}
+	if sym.label != nil {
+		locs = append(locs, Location{d.uri, d.tokenRange(sym.label.def)})
+	} else {
+		for _, r := range d.rulesNamed(sym.rule) {
+			locs = append(locs, Location{d.uri, d.tokenRange(r.def)})
+		}
+	}
+	return locs, nil
+}
+
+func (s *server) references(p ReferenceParams) (interface{}, error) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	sym := d.symbolAt(d.pos(p.Position))
+	if sym == nil {
+		return nil, nil
+	}
+	ranges := []Range{}
+	if sym.label != nil {
+		ranges = d.labelRanges(sym.label)
+		if !p.Context.IncludeDeclaration {
+			ranges = ranges[1:]
+		}
+	} else {
+		ranges = d.ruleRanges(sym.rule, p.Context.IncludeDeclaration)
+	}
+
+	locs := []Location{}
+	for _, r := range ranges {
+		locs = append(locs, Location{d.uri, r})
+	}
+	return locs, nil
+}
+
+func (s *server) hover(p TextDocumentPositionParams) (interface{}, error) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	sym := d.symbolAt(d.pos(p.Position))
+	if sym == nil || sym.label != nil {
+		return nil, nil
+	}
+	rules := d.rulesNamed(sym.rule)
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	return Hover{
+		Contents: MarkupContent{"markdown", "```peg\n" + d.ruleText(rules[0]) + "\n```"},
+		Range:    sym.r,
+	}, nil
+}
+
+var identRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (s *server) rename(p RenameParams) (interface{}, error) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	sym := d.symbolAt(d.pos(p.Position))
+	if sym == nil {
+		return nil, &responseError{codeInvalidParams, "no rule or label at position"}
+	}
+	if !identRegexp.MatchString(p.NewName) {
+		return nil, &responseError{codeInvalidParams, "invalid name " + p.NewName}
+	}
+	if tt := peg.NewScanner(strings.NewReader(p.NewName), peg.BufferSize).Scan().Type; tt != peg.IDENT || indentKeywords[p.NewName] {
+		return nil, &responseError{codeInvalidParams, "name is keyword " + p.NewName}
+	}
+
+	ranges := []Range{}
+	if sym.label != nil {
+		// labels are variables of action code
+		if !token.IsIdentifier(p.NewName) || token.IsKeyword(p.NewName) {
+			return nil, &responseError{codeInvalidParams, "name is not a Go identifier " + p.NewName}
+		}
+		ranges = d.labelRanges(sym.label)
+	} else {
+		if p.NewName != sym.rule && len(d.rulesNamed(p.NewName)) > 0 {
+			return nil, &responseError{codeInvalidParams, "rule " + p.NewName + " already exists"}
+		}
+		ranges = d.ruleRanges(sym.rule, true)
+	}
+
+	edits := []TextEdit{}
+	for _, r := range ranges {
+		edits = append(edits, TextEdit{r, p.NewName})
+	}
+	return WorkspaceEdit{map[string][]TextEdit{d.uri: edits}}, nil
+}
+
+func (s *server) symbols(p DocumentParams) (interface{}, error) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := []DocumentSymbol{}
+	for _, r := range d.rules {
+		sel := d.tokenRange(r.def)
+		end := d.end()
+		if r.end < len(d.tokens) && d.tokens[r.end].Type != peg.EOF {
+			end = d.position(d.tokens[r.end].Pos)
+		}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           r.name,
+			Kind:           symbolFunction,
+			Range:          Range{sel.Start, end},
+			SelectionRange: sel,
+		})
+	}
+	return symbols, nil
+}
+
+func (s *server) format(p DocumentParams) (interface{}, error) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	edits := []TextEdit{}
+	if !d.ok {
+		return edits, nil
+	}
+	if text := d.format(); text != d.text {
+		edits = append(edits, TextEdit{Range{Position{}, d.end()}, text})
+	}
+	return edits, nil
+}
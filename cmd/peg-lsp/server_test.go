@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+)
+
+const uri = "file:///expr.peg"
+
+const grammar = `Expr = l:Term "+" r:Term { return l }
+Term = n:NUMBER
+NUMBER = [0-9]+
+`
+
+// client talks to a server through pipes, like an editor on its stdin and
+// stdout.
+type client struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  *bufio.Reader
+	id   int
+	done chan error
+}
+
+func newClient(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, in: inW, out: bufio.NewReader(outR), done: make(chan error, 1)}
+	go func() {
+		err := newServer(outW).serve(inR)
+		outW.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) send(id *int, method string, params interface{}) {
+	c.t.Helper()
+
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if id != nil {
+		msg["id"] = *id
+	}
+	if err := writeMessage(c.in, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) read(v interface{}) {
+	c.t.Helper()
+
+	body, err := readMessage(c.out)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		c.t.Fatalf("%v: %s", err, body)
+	}
+}
+
+// call sends a request, and decodes the result of its response into result.
+func (c *client) call(method string, params, result interface{}) {
+	c.t.Helper()
+
+	raw, err := c.request(method, params)
+	if err != nil {
+		c.t.Fatalf("%s: error %v", method, err)
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		c.t.Fatalf("%s: %v: %s", method, err, raw)
+	}
+}
+
+// callError sends a request, and returns the error of its response.
+func (c *client) callError(method string, params interface{}) *responseError {
+	c.t.Helper()
+
+	raw, err := c.request(method, params)
+	if err == nil {
+		c.t.Fatalf("%s: result %s, want error", method, raw)
+	}
+	return err
+}
+
+func (c *client) request(method string, params interface{}) (json.RawMessage, *responseError) {
+	c.t.Helper()
+
+	c.id++
+	c.send(&c.id, method, params)
+	resp := struct {
+		ID     int
+		Result json.RawMessage
+		Error  *responseError
+	}{}
+	c.read(&resp)
+	if resp.ID != c.id {
+		c.t.Fatalf("%s: response %d, want %d", method, resp.ID, c.id)
+	}
+	return resp.Result, resp.Error
+}
+
+// open opens a document, and returns its diagnostics.
+func (c *client) open(text string) []Diagnostic {
+	c.t.Helper()
+
+	params := DidOpenTextDocumentParams{}
+	params.TextDocument.URI = uri
+	params.TextDocument.Text = text
+	c.send(nil, "textDocument/didOpen", params)
+
+	n := struct {
+		Method string
+		Params PublishDiagnosticsParams
+	}{}
+	c.read(&n)
+	if n.Method != "textDocument/publishDiagnostics" || n.Params.URI != uri {
+		c.t.Fatalf("got %s of %s, want diagnostics of %s", n.Method, n.Params.URI, uri)
+	}
+	return n.Params.Diagnostics
+}
+
+func at(line, char int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{line, char}}
+}
+
+func span(line, start, end int) Range {
+	return Range{Position{line, start}, Position{line, end}}
+}
+
+func TestServer(t *testing.T) {
+	c := newClient(t)
+
+	c.call("initialize", map[string]interface{}{}, &map[string]interface{}{})
+	c.send(nil, "initialized", map[string]interface{}{})
+
+	diags := c.open("Expr = Term\n")
+	if len(diags) != 1 || diags[0].Range != span(0, 7, 11) {
+		t.Errorf("diagnostics = %+v, want one at Term", diags)
+	}
+	if diags := c.open(grammar); len(diags) != 0 {
+		t.Errorf("diagnostics = %+v, want none", diags)
+	}
+
+	locs := []Location{}
+	c.call("textDocument/definition", at(0, 10), &locs)
+	if want := []Location{{uri, span(1, 0, 4)}}; !reflect.DeepEqual(locs, want) {
+		t.Errorf("definition = %+v, want %+v", locs, want)
+	}
+
+	refs := ReferenceParams{TextDocumentPositionParams: at(1, 1)}
+	refs.Context.IncludeDeclaration = true
+	c.call("textDocument/references", refs, &locs)
+	if want := []Location{{uri, span(1, 0, 4)}, {uri, span(0, 9, 13)}, {uri, span(0, 20, 24)}}; !reflect.DeepEqual(locs, want) {
+		t.Errorf("references = %+v, want %+v", locs, want)
+	}
+
+	edit := WorkspaceEdit{}
+	c.call("textDocument/rename", RenameParams{at(0, 7), "left"}, &edit)
+	if want := []TextEdit{{span(0, 7, 8), "left"}, {span(0, 34, 35), "left"}}; !reflect.DeepEqual(edit.Changes[uri], want) {
+		t.Errorf("rename = %+v, want %+v", edit.Changes[uri], want)
+	}
+
+	for _, name := range []string{"func", "a-b", "INDENT"} {
+		if err := c.callError("textDocument/rename", RenameParams{at(0, 7), name}); err.Code != codeInvalidParams {
+			t.Errorf("rename to %s: %v, want invalid params", name, err)
+		}
+	}
+
+	hover := Hover{}
+	c.call("textDocument/hover", at(0, 22), &hover)
+	if want := "```peg\nTerm = n:NUMBER\n```"; hover.Contents.Value != want || hover.Range != span(0, 20, 24) {
+		t.Errorf("hover = %+v, want %q", hover, want)
+	}
+
+	symbols := []DocumentSymbol{}
+	c.call("textDocument/documentSymbol", DocumentParams{TextDocumentIdentifier{uri}}, &symbols)
+	names := []string{}
+	for _, s := range symbols {
+		names = append(names, s.Name)
+	}
+	if want := []string{"Expr", "Term", "NUMBER"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("symbols = %v, want %v", names, want)
+	}
+
+	edits := []TextEdit{}
+	c.call("textDocument/formatting", DocumentParams{TextDocumentIdentifier{uri}}, &edits)
+	if len(edits) != 0 {
+		t.Errorf("formatting = %+v, want no edits", edits)
+	}
+	c.open("Expr = Term  \n    / \"y\"\n\n\n\nTerm = \"x\"\n")
+	c.call("textDocument/formatting", DocumentParams{TextDocumentIdentifier{uri}}, &edits)
+	if len(edits) != 1 || edits[0].NewText != "Expr = Term\n\t/ \"y\"\n\nTerm = \"x\"\n" {
+		t.Errorf("formatting = %+v", edits)
+	}
+
+	// INDENT is not a rule unless defined
+	c.open("Block = INDENT Line DEDENT\nLine = \"x\"\n")
+	locs = nil
+	c.call("textDocument/references", ReferenceParams{TextDocumentPositionParams: at(0, 9)}, &locs)
+	if locs != nil {
+		t.Errorf("references of INDENT = %+v, want none", locs)
+	}
+
+	var null interface{}
+	c.call("shutdown", nil, &null)
+	if err := c.callError("textDocument/hover", at(0, 22)); err.Code != codeInvalidRequest {
+		t.Errorf("hover after shutdown: %v, want invalid request", err)
+	}
+	c.send(nil, "exit", nil)
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
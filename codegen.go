@@ -9,77 +9,209 @@ import (
 	"unicode/utf8"
 )
 
+// header takes the type of input and additional fields of parserLimits.
 const header = `
 var pegErr = errors.New("PEG ERROR")
 
-func Parse(src []rune) (interface{}, error) {
-	p := parser{src, 0}
-	return p.rule_%s()
+func Parse(src %[1]s) (interface{}, error) {
+	return NewParser(src).Parse()
 }
 
-type parser struct {
-	src []rune
-	n   int
+func ParseContext(ctx context.Context, src %[1]s, opts ...Option) (interface{}, error) {
+	return NewParser(src, opts...).ParseContext(ctx)
 }
 
-func (__p *parser) advance(n int) {
-	__p.n += n
+type Parser struct {
+	src    %[1]s
+	limits parserLimits
+	p      *parser
 }
 
-func (__p *parser) backTo(n int) {
-	__p.n = n
+func NewParser(src %[1]s, opts ...Option) *Parser {
+	p := &Parser{src: src}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
-func (__p *parser) expectDot(advance bool) (interface{}, error) {
-	if __p.n < len(__p.src) {
-		r := string(__p.src[__p.n])
-		if advance {
-			__p.advance(1)
-		}
-		return r, nil
+func (p *Parser) Parse() (interface{}, error) {
+	return p.ParseContext(context.Background())
+}
+
+type parserLimits struct {
+	maxDepth      int
+	maxBacktracks int%[2]s
+}
+
+type Option func(*Parser)
+
+// MaxDepth limits depth of rule recursion.
+func MaxDepth(n int) Option {
+	return func(p *Parser) {
+		p.limits.maxDepth = n
 	}
-	return nil, pegErr
 }
 
-func (__p *parser) expectString(advance bool, str string, l int) (interface{}, error) {
-	if __p.n + l <= len(__p.src) && str == string(__p.src[__p.n:__p.n+l]) {
-		if advance {
-			__p.advance(l)
-		}
-		return str, nil
+// MaxBacktracks limits the number of backtracks.
+func MaxBacktracks(n int) Option {
+	return func(p *Parser) {
+		p.limits.maxBacktracks = n
 	}
-	return nil, pegErr
 }
+`
 
-func (__p *parser) expectChar(advance bool, chars ...rune) (interface{}, error) {
-	if __p.n < len(__p.src) {
-		c := __p.src[__p.n]
-		for i := 0; i < len(chars); i += 2 {
-			if chars[i] <= c && c <= chars[i+1] {
-				if advance {
-					__p.advance(1)
+const parseFunc = `
+var (
+	ErrMaxDepth      = errors.New("maximum recursion depth exceeded")
+	ErrMaxBacktracks = errors.New("maximum backtrack steps exceeded")
+)
+
+func (p *Parser) ParseContext(ctx context.Context) (ret interface{}, err error) {
+	p.p = newParser(p.src, p.p)
+	p.p.ctx = ctx
+	p.p.done = ctx.Done()
+	p.p.limits = p.limits
+
+	defer func() {
+		if r := recover(); r != nil {
+			if a, ok := r.(parseAbort); ok {
+				ret, err = nil, a.err
+				if e, ok := a.err.(*SyntaxError); ok {
+					err = append(ErrorList(p.p.errs), e)
 				}
-				return string(c), nil
+				return
 			}
+			panic(r)
 		}
+	}()
+
+	ret, err = p.p.rule_%s()
+	if err == nil && len(p.p.errs) > 0 {
+		err = ErrorList(p.p.errs)
 	}
-	return nil, pegErr
+	return
 }
 
-func (__p *parser) expectCharNot(advance bool, chars ...rune) (interface{}, error) {
-	if __p.n < len(__p.src) {
-		c := __p.src[__p.n]
-		for i := 0; i < len(chars); i += 2 {
-			if chars[i] <= c && c <= chars[i+1] {
-				return nil, pegErr
-			}
+type parseAbort struct {
+	err error
+}
+
+func (__p *parser) abort(err error) {
+	__p.aborted = true
+	panic(parseAbort{err})
+}
+
+func (__p *parser) enter() {
+	__p.depth++
+	if __p.limits.maxDepth > 0 && __p.depth > __p.limits.maxDepth {
+		__p.abort(ErrMaxDepth)
+	}
+
+	__p.steps++
+	if __p.done != nil && __p.steps%%1024 == 0 {
+		select {
+		case <-__p.done:
+			__p.abort(__p.ctx.Err())
+		default:
 		}
-		if advance {
-			__p.advance(1)
+	}
+}
+
+func (__p *parser) leave() {
+	__p.depth--
+}
+`
+
+const errorFuncs = `
+type SyntaxError struct {
+	Pos  int // offset in src
+	End  int // offset where parsing resumed
+	Line int
+	Col  int
+	Rule string
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Msg)
+}
+
+// ErrorList is returned with the partial result if syntax errors were
+// recovered.
+type ErrorList []*SyntaxError
+
+func (l ErrorList) Error() string {
+	buf := &bytes.Buffer{}
+	for i, e := range l {
+		if i > 0 {
+			buf.WriteString("\n")
 		}
-		return string(c), nil
+		buf.WriteString(e.Error())
+	}
+	return buf.String()
+}
+
+func (__p *parser) syntaxError(pos int, rule, msg string) *SyntaxError {
+	line, col := __p.position(pos)
+	return &SyntaxError{Pos: pos, End: pos, Line: line, Col: col, Rule: rule, Msg: msg}
+}
+
+// throw raises a syntax error, which fails parsing unless caught.
+func (__p *parser) throw(rule, msg string) {
+	__p.aborted = true
+	panic(parseAbort{__p.syntaxError(__p.n, rule, msg)})
+}
+
+// catch runs f, turning a raised syntax error into a failure to be recovered.
+func (__p *parser) catch(f func() (interface{}, error)) (ret interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if a, ok := r.(parseAbort); ok {
+				if e, ok := a.err.(*SyntaxError); ok {
+					__p.aborted = false
+					__p.thrown = e
+					ret, err = nil, pegErr
+					return
+				}
+			}
+			panic(r)
+		}
+	}()
+	return f()
+}
+
+// recoverWith records a syntax error, the one caught if any, and skips input
+// with sync, which must consume input.
+func (__p *parser) recoverWith(rule string, sync func() (interface{}, error)) (interface{}, error) {
+	pos := __p.n
+	if _, err := sync(); err != nil || __p.n == pos {
+		return nil, pegErr
+	}
+	e := __p.syntaxError(pos, rule, "syntax error in "+rule)
+	if __p.thrown != nil {
+		e, __p.thrown = __p.thrown, nil
+	}
+	e.End = __p.n
+	__p.errs = append(__p.errs, e)
+	return e, nil
+}
+`
+
+const advanceFunc = `
+func (__p *parser) advance(n int) {
+	__p.n += n
+}
+`
+
+const matchFuncs = `
+func (__p *parser) backTo(n int) {
+	__p.n = n
+
+	__p.backtracks++
+	if __p.limits.maxBacktracks > 0 && __p.backtracks > __p.limits.maxBacktracks {
+		__p.abort(ErrMaxBacktracks)
 	}
-	return nil, pegErr
 }
 
 func (__p *parser) zeroOrOne(pe func() (interface{}, error)) (interface{}, error) {
@@ -122,10 +254,136 @@ func (__p *parser) zeroOrMore(pe func() (interface{}, error)) (interface{}, erro
 	return ret, nil
 }
 
+func (__p *parser) skipOneOrMore(pe func() (interface{}, error)) (interface{}, error) {
+	if _, err := pe(); err != nil {
+		return nil, pegErr
+	}
+	for {
+		if _, err := pe(); err != nil {
+			return nil, nil
+		}
+	}
+}
+
+func (__p *parser) skipZeroOrMore(pe func() (interface{}, error)) (interface{}, error) {
+	for {
+		if _, err := pe(); err != nil {
+			return nil, nil
+		}
+	}
+}
+`
+
+const runeFuncs = `
+func (__p *parser) position(pos int) (line, col int) {
+	line, col = 1, 1
+	for _, c := range __p.src[:pos] {
+		if c == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return
+}
+
+func (__p *parser) expectDot(advance bool) (interface{}, error) {
+	if __p.n < len(__p.src) {
+		r := string(__p.src[__p.n])
+		if advance {
+			__p.advance(1)
+		}
+		return r, nil
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) expectString(advance bool, str string, l int) (interface{}, error) {
+	if __p.hasString(str, l) {
+		if advance {
+			__p.advance(l)
+		}
+		return str, nil
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) hasString(str string, l int) bool {
+	if __p.n+l > len(__p.src) {
+		return false
+	}
+	i := __p.n
+	for _, r := range str {
+		if __p.src[i] != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
+`
+
+const tokenFuncs = `
+// Token is an element of input. Terminals match tokens by Kind or Text.
+type Token interface {
+	Kind() string
+	Text() string
+}
+
+// position returns the position of token pos if it has method
+// Pos() (line, col int).
+func (__p *parser) position(pos int) (line, col int) {
+	if pos < len(__p.src) {
+		if t, ok := __p.src[pos].(interface{ Pos() (int, int) }); ok {
+			return t.Pos()
+		}
+	}
+	return 0, 0
+}
+
+func (__p *parser) expectDot(advance bool) (interface{}, error) {
+	if __p.n < len(__p.src) {
+		t := __p.src[__p.n]
+		if advance {
+			__p.advance(1)
+		}
+		return t, nil
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) expectKind(advance bool, kind string) (interface{}, error) {
+	if __p.n < len(__p.src) && __p.src[__p.n].Kind() == kind {
+		t := __p.src[__p.n]
+		if advance {
+			__p.advance(1)
+		}
+		return t, nil
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) expectText(advance bool, text string) (interface{}, error) {
+	if __p.n < len(__p.src) && __p.src[__p.n].Text() == text {
+		t := __p.src[__p.n]
+		if advance {
+			__p.advance(1)
+		}
+		return t, nil
+	}
+	return nil, pegErr
+}
+`
+
+const valueFuncs = `
 func String(r interface{}) string {
 	if r == nil {
 		return ""
 	}
+	if t, ok := r.(interface{ Text() string }); ok {
+		return t.Text()
+	}
 
 	switch reflect.TypeOf(r).Kind() {
 	case reflect.Array:
@@ -162,32 +420,542 @@ func main() {
 
 	tree.(*Tree).GenCode(os.Stdout)
 }
-`
+`
+
+const profileHeader = `
+type RuleStats struct {
+	Rule        string
+	Invocations int
+	Successes   int
+	Failures    int
+	Backtracks  int
+	Time        time.Duration // including rules called from this rule
+
+	active int
+}
+
+// Stats returns per rule statistics of the last Parse.
+func (p *Parser) Stats() []RuleStats {
+	if p.p == nil {
+		return nil
+	}
+	stats := make([]RuleStats, len(p.p.stats))
+	copy(stats, p.p.stats)
+	return stats
+}
+
+type ruleFrame struct {
+	rule  int
+	prev  int
+	start time.Time
+}
+
+func (__p *parser) enterRule(rule int) ruleFrame {
+	s := &__p.stats[rule]
+	s.Invocations++
+	s.active++
+	f := ruleFrame{rule, __p.rule, time.Now()}
+	__p.rule = rule
+	return f
+}
+
+func (__p *parser) leaveRule(f ruleFrame, err *error) {
+	s := &__p.stats[f.rule]
+	s.active--
+	if s.active == 0 {
+		s.Time += time.Since(f.start)
+	}
+	if *err == nil {
+		s.Successes++
+	} else {
+		s.Failures++
+	}
+	__p.rule = f.prev
+}
+`
+
+// memoHeader takes fields of memoKey and memoEntry, and code saving parser
+// state in the entry, which are empty unless the grammar has %state.
+const memoHeader = `
+var ErrMaxMemoSize = errors.New("maximum memo table size exceeded")
+
+// MaxMemoSize limits the number of memo table entries.
+func MaxMemoSize(n int) Option {
+	return func(p *Parser) {
+		p.limits.maxMemoSize = n
+	}
+}
+
+type memoKey struct {
+	rule int
+	pos  int%s
+}
+
+type memoEntry struct {
+	ret  interface{}
+	err  error
+	end  int
+	far  int            // furthest position reached in the rule
+	errs []*SyntaxError // recovered in the rule%s
+}
+
+// memoize stores the result of a rule, where far is the furthest position
+// reached before the rule.
+func (__p *parser) memoize(key memoKey, nerrs, far int, ret *interface{}, err *error) {
+	if __p.aborted {
+		return
+	}
+	if __p.limits.maxMemoSize > 0 && len(__p.memo) >= __p.limits.maxMemoSize {
+		__p.abort(ErrMaxMemoSize)
+	}
+	e := memoEntry{ret: *ret, err: *err, end: __p.n, far: __p.far}
+	if len(__p.errs) > nerrs {
+		e.errs = append([]*SyntaxError{}, __p.errs[nerrs:]...)
+	}%s
+	__p.memo[key] = e
+
+	if far > __p.far {
+		__p.far = far
+	}
+}
+
+// advance also records the furthest position reached, which bounds input
+// examined by memoized rules.
+func (__p *parser) advance(n int) {
+	__p.n += n
+	if __p.n > __p.far {
+		__p.far = __p.n
+	}
+}
+`
+
+// editFunc takes the type of input.
+const editFunc = `
+// Edit replaces src[start:end] with text. The next Parse reuses results of
+// rules from the last parse which did not examine the replaced input, so only
+// rules around the edit are parsed again. Values and errors of reused results
+// keep their old positions, and results with recovered errors are dropped.
+func (p *Parser) Edit(start, end int, text %[1]s) {
+	src := make(%[1]s, 0, len(p.src)-(end-start)+len(text))
+	src = append(src, p.src[:start]...)
+	src = append(src, text...)
+	p.src = append(src, p.src[end:]...)
+
+	if p.p == nil {
+		return
+	}
+	delta := len(text) - (end - start)
+	type shifted struct {
+		k memoKey
+		e memoEntry
+	}
+	moved := []shifted{}
+	for k, e := range p.p.memo {
+		if e.errs == nil && (e.far+__peg_lookahead <= start || k.pos >= end && delta == 0) {
+			continue
+		}
+		delete(p.p.memo, k)
+		if e.errs == nil && k.pos >= end {
+			k.pos += delta
+			e.end += delta
+			e.far += delta
+			moved = append(moved, shifted{k, e})
+		}
+	}
+	for _, m := range moved {
+		p.p.memo[m.k] = m.e
+	}
+}
+`
+
+const stateHeader = `
+type stateSnapshot struct {
+	state parserState
+	id    int
+}
+
+// cloneState returns a copy of s which can be changed without changing s.
+// parserState can define Clone to copy its maps and slices.
+func cloneState(s parserState) parserState {
+	if c, ok := interface{}(s).(interface{ Clone() parserState }); ok {
+		return c.Clone()
+	}
+	return s
+}
+
+func (__p *parser) saveState() stateSnapshot {
+	return stateSnapshot{__p.state, __p.stateID}
+}
+
+func (__p *parser) restoreState(s stateSnapshot) {
+	__p.state, __p.stateID = s.state, s.id
+}
+
+// stateChanged is called before state code runs, so saved snapshots keep
+// the old state.
+func (__p *parser) stateChanged() {
+	__p.state = cloneState(__p.state)
+	__p.stateSeq++
+	__p.stateID = __p.stateSeq
+}
+
+// undoable wraps pe to restore parser state when pe fails.
+func (__p *parser) undoable(pe func() (interface{}, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		s := __p.saveState()
+		r, err := pe()
+		if err != nil {
+			__p.restoreState(s)
+		}
+		return r, err
+	}
+}
+`
+
+// indentHeader takes code recording input examined by indentation.
+const indentHeader = `
+// indentLevel is an entry of the indentation stack, which is never changed so
+// that state snapshots can share it.
+type indentLevel struct {
+	width int
+	prev  *indentLevel
+}
+
+func (l *indentLevel) Width() int {
+	if l == nil {
+		return 0
+	}
+	return l.width
+}
+
+// indentation returns the width of indentation of the next non-blank line,
+// and the offset after it. Tabs move to the next multiple of 8 columns. ok is
+// false if the position is not at the end of a line, as in the middle of one
+// or after its indentation. At the end of input, width is 0.
+func (__p *parser) indentation() (width, end int, ok bool) {
+	start := __p.n // start of the line
+	for end = __p.n; end < len(__p.src); end++ {
+		c := __p.src[end]
+		if c == '\n' || c == '\r' {
+			start = end + 1
+			ok = true
+		} else if c != ' ' && c != '\t' {
+			break
+		}
+	}%s
+	if end == len(__p.src) {
+		return 0, end, true
+	}
+	for _, c := range __p.src[start:end] {
+		if c == '\t' {
+			width += 8 - width%%8
+		} else {
+			width++
+		}
+	}
+	return width, end, ok
+}
+
+// indent and samedent match a line break, so that they fail at the end of
+// input and cannot match twice at a position.
+func (__p *parser) indent(advance bool) (interface{}, error) {
+	width, end, ok := __p.indentation()
+	if !ok || end == len(__p.src) || width <= __p.state.__peg_indents.Width() {
+		return nil, pegErr
+	}
+	__p.stateChanged()
+	__p.state.__peg_indents = &indentLevel{width, __p.state.__peg_indents}
+	if advance {
+		__p.advance(end - __p.n)
+	}
+	return nil, nil
+}
+
+func (__p *parser) samedent(advance bool) (interface{}, error) {
+	width, end, ok := __p.indentation()
+	if !ok || end == len(__p.src) || width != __p.state.__peg_indents.Width() {
+		return nil, pegErr
+	}
+	if advance {
+		__p.advance(end - __p.n)
+	}
+	return nil, nil
+}
+
+// dedent pops a level without consuming input, so that several blocks can end
+// at a line. It raises a syntax error if the line is between two levels.
+func (__p *parser) dedent(rule string) (interface{}, error) {
+	width, end, ok := __p.indentation()
+	l := __p.state.__peg_indents
+	if !ok || width >= l.Width() {
+		return nil, pegErr
+	}
+	if width > l.prev.Width() {
+		__p.n = end
+		__p.throw(rule, "inconsistent indentation")
+	}
+	__p.stateChanged()
+	__p.state.__peg_indents = l.prev
+	return nil, nil
+}
+`
+
+func (tree *Tree) GenCode(out io.Writer) {
+	Upgrade(tree)
+	tree.genImports(out, tree.requiredImports())
+
+	if tree.Package == "main" {
+		fmt.Fprint(out, mainFunc)
+	}
+
+	if Memoize {
+		fmt.Fprintf(out, header, inputType(), "\n\tmaxMemoSize   int")
+	} else {
+		fmt.Fprintf(out, header, inputType(), "")
+	}
+	fmt.Fprintf(out, parseFunc, tree.RuleList[0].Name)
+	io.WriteString(out, errorFuncs)
+	if !Memoize {
+		fmt.Fprint(out, advanceFunc)
+	}
+	fmt.Fprint(out, matchFuncs)
+	if TokenInput {
+		fmt.Fprint(out, tokenFuncs)
+	} else {
+		fmt.Fprint(out, runeFuncs)
+	}
+	fmt.Fprint(out, valueFuncs)
+
+	indentation = false
+	for _, r := range tree.RuleList {
+		if r.ChoiceExpr.hasIndent() {
+			indentation = true
+		}
+	}
+	stateful = tree.State != "" || indentation
+
+	tree.genParser(out)
+
+	if Memoize {
+		if stateful {
+			fmt.Fprintf(out, memoHeader,
+				"\n	state int // id of parser state",
+				"\n	state stateSnapshot // parser state after the rule",
+				"\n	e.state = __p.saveState()",
+			)
+		} else {
+			fmt.Fprintf(out, memoHeader, "", "", "")
+		}
+		fmt.Fprintf(out, editFunc, inputType())
+		fmt.Fprintf(out, "\n// longest input examined by a terminal\nconst __peg_lookahead = %d\n", tree.lookahead())
+	}
+
+	if stateful {
+		fmt.Fprintf(out, "\ntype parserState struct {\n%s\n", tree.State)
+		if indentation {
+			fmt.Fprintln(out, "\n__peg_indents *indentLevel // indentation stack")
+		}
+		fmt.Fprint(out, "}\n")
+		fmt.Fprint(out, stateHeader)
+	}
+
+	if indentation {
+		if Memoize {
+			// dedent does not advance, and indent and samedent match
+			// indentation followed by a character they do not consume
+			fmt.Fprintf(out, indentHeader, "\n\tif end > __p.far {\n\t\t__p.far = end\n\t}")
+		} else {
+			fmt.Fprintf(out, indentHeader, "")
+		}
+	}
+
+	if Profile {
+		fmt.Fprint(out, profileHeader)
+	}
+
+	recognizable = map[string]*Rule{}
+	recognizerNeeded = map[string]bool{}
+	recovery = false
+	for _, r := range tree.RuleList {
+		if r.ChoiceExpr.hasRecover() {
+			recovery = true
+		}
+	}
+	for _, r := range tree.RuleList {
+		if !r.ChoiceExpr.hasCode() {
+			recognizable[r.Name] = r
+		}
+	}
+
+	hasSkip = tree.Skip != nil
+	if hasSkip {
+		genSkip(out, tree.Skip)
+	}
+
+	for _, r := range tree.RuleList {
+		r.GenCode(out)
+	}
+
+	for len(recognizerQueue) > 0 {
+		r := recognizerQueue[0]
+		recognizerQueue = recognizerQueue[1:]
+		r.genRecognizer(out)
+	}
+
+	io.Copy(out, classTables)
+
+	fmt.Fprint(out, tree.Grammar.Code)
+
+	io.Copy(out, userCode)
+}
 
-func (tree *Tree) GenCode(out io.Writer) {
+func (tree *Tree) genImports(out io.Writer, required []string) {
 	fmt.Fprintf(out, "package %s\n", tree.Package)
 
+	imported := map[string]bool{}
 	for _, i := range tree.Import {
 		if i.Name == "" {
 			fmt.Fprintf(out, "import %q\n", i.Path)
 		} else {
 			fmt.Fprintf(out, "import %s %q\n", i.Name, i.Path)
 		}
+		if i.Name == "" || i.Name == "." {
+			imported[i.Path] = true
+		}
 	}
-
-	if tree.Package == "main" {
-		fmt.Fprint(out, mainFunc)
+	for _, path := range required {
+		if !imported[path] {
+			fmt.Fprintf(out, "import %q\n", path)
+		}
 	}
+}
 
-	fmt.Fprintf(out, header, tree.RuleList[0].Name)
+// inputType returns the type of input of generated parsers.
+func inputType() string {
+	if TokenInput {
+		return "[]Token"
+	}
+	return "[]rune"
+}
 
+// lookahead returns the longest input examined by a terminal of tree.
+func (tree *Tree) lookahead() int {
+	l := 1
+	stack := []*ChoiceExpr{}
 	for _, r := range tree.RuleList {
-		r.GenCode(out)
+		stack = append(stack, r.ChoiceExpr)
+	}
+	if tree.Skip != nil {
+		stack = append(stack, tree.Skip)
+	}
+	for len(stack) > 0 {
+		for _, ae := range stack[0].ActionExprs {
+			for _, le := range ae.SeqExpr.LabeledExprs {
+				switch pe := le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(type) {
+				case *LitMatcher:
+					if n := utf8.RuneCountInString(pe.Lit); n > l && !TokenInput {
+						l = n
+					}
+				case *SubExpr:
+					stack = append(stack, pe.ChoiceExpr)
+				}
+			}
+		}
+		stack = stack[1:]
 	}
+	return l
+}
 
-	fmt.Fprint(out, tree.Grammar.Code)
+// requiredImports returns packages used by generated code besides those in header.
+func (tree *Tree) requiredImports() []string {
+	imports := []string{"context"}
+	if Profile {
+		imports = append(imports, "time")
+	}
+	return imports
+}
 
-	io.Copy(out, userCode)
+func (tree *Tree) genParser(out io.Writer) {
+	fmt.Fprint(out,
+		"type parser struct {\n"+
+			"	src "+inputType()+"\n"+
+			"	n   int\n"+
+			"\n"+
+			"	ctx        context.Context\n"+
+			"	done       <-chan struct{}\n"+
+			"	limits     parserLimits\n"+
+			"	depth      int\n"+
+			"	steps      int\n"+
+			"	backtracks int\n"+
+			"	aborted    bool\n"+
+			"\n"+
+			"	errs   []*SyntaxError\n"+
+			"	thrown *SyntaxError // caught to be recovered\n",
+	)
+	if Memoize {
+		fmt.Fprint(out,
+			"\n"+
+				"	memo map[memoKey]memoEntry\n"+
+				"	far  int // furthest position reached\n",
+		)
+	}
+	if stateful {
+		fmt.Fprint(out,
+			"\n"+
+				"	state    parserState\n"+
+				"	stateID  int // id of state, changed by state code\n"+
+				"	stateSeq int // last id\n",
+		)
+	}
+	if Profile {
+		fmt.Fprint(out,
+			"\n"+
+				"	rule  int // current rule\n"+
+				"	stats []RuleStats\n",
+		)
+	}
+	fmt.Fprint(out, "}\n\n")
+
+	fmt.Fprint(out,
+		"// newParser returns a parser for src, reusing results of prev.\n"+
+			"func newParser(src "+inputType()+", prev *parser) *parser {\n"+
+			"	__p := &parser{src: src}\n",
+	)
+	if Memoize {
+		fmt.Fprint(out,
+			"	__p.memo = map[memoKey]memoEntry{}\n"+
+				"	if prev != nil {\n"+
+				"		__p.memo = prev.memo\n",
+		)
+		if stateful {
+			// states of reused results keep their ids
+			fmt.Fprintln(out, "		__p.stateSeq = prev.stateSeq")
+		}
+		fmt.Fprintln(out, "	}")
+	}
+	if Profile {
+		fmt.Fprintf(out,
+			"	__p.stats = make([]RuleStats, %d)\n"+
+				"	for i := range __p.stats {\n"+
+				"		__p.stats[i].Rule = __peg_ruleNames[i]\n"+
+				"	}\n",
+			len(tree.RuleList),
+		)
+	}
+	fmt.Fprint(out, "	return __p\n}\n\n")
+
+	fmt.Fprintln(out, "const (")
+	for n, r := range tree.RuleList {
+		fmt.Fprintf(out, "	__peg_rule_%s = %d\n", r.Name, n)
+	}
+	fmt.Fprintf(out, "\n	__peg_numRules = %d\n", len(tree.RuleList))
+	fmt.Fprint(out, ")\n\n")
+
+	fmt.Fprint(out, "var __peg_ruleNames = [...]string{\n")
+	for _, r := range tree.RuleList {
+		fmt.Fprintf(out, "	%q,\n", r.Name)
+	}
+	fmt.Fprint(out, "}\n")
 }
 
 func (r *Rule) GenCode(out io.Writer) {
@@ -195,30 +963,317 @@ func (r *Rule) GenCode(out io.Writer) {
 	r.Print(out)
 	fmt.Fprintln(out, "")
 
-	fmt.Fprintf(out, "func (__p *parser) rule_%s() (interface{}, error) {\n", r.Name)
+	r.genFunc(out, "rule_")
+}
+
+// Rules without action code, whose recognizer can be called where their
+// value is discarded.
+var recognizable = map[string]*Rule{}
+var recognizerQueue = []*Rule{}
+var recognizerNeeded = map[string]bool{}
+
+// recognizer returns the function only matching rule name, or "" if rule has
+// action code.
+func recognizer(name string) string {
+	r, ok := recognizable[name]
+	if !ok {
+		return ""
+	}
+	if !recognizerNeeded[name] {
+		recognizerNeeded[name] = true
+		recognizerQueue = append(recognizerQueue, r)
+	}
+	return "skip_" + name
+}
+
+func (r *Rule) genRecognizer(out io.Writer) {
+	fmt.Fprint(out, "// Recognizer: ")
+	r.Print(out)
+	fmt.Fprintln(out, "")
+
+	discard = true
+	defer func() {
+		discard = false
+	}()
+
+	r.genFunc(out, "skip_")
+}
+
+// ruleName is the name of the rule being generated.
+var ruleName string
+
+// hasSkip is true if the grammar has %skip, and skipping is true when
+// generating a syntactic rule, where it is matched before tokens.
+var hasSkip = false
+var skipping = false
+
+// genSkip generates skip, which matches ce until it fails or consumes nothing.
+func genSkip(out io.Writer, ce *ChoiceExpr) {
+	ruleName = "%skip"
+	skipping = false
+
+	discard = true
+	defer func() {
+		discard = false
+	}()
+
+	fmt.Fprintln(out, "func (__p *parser) skip() {")
+	fmt.Fprintln(out, "for {")
+	fmt.Fprintln(out, "__peg_start := __p.n")
+	fmt.Fprintln(out, "if _, err := func() (interface{}, error) {")
+	ce.GenCode(out)
+	fmt.Fprintln(out, "return nil, pegErr")
+	fmt.Fprint(out,
+		"}(); err != nil || __p.n == __peg_start {\n"+
+			"	return\n"+
+			"}\n",
+	)
+	fmt.Fprint(out, "}\n}\n\n")
+}
+
+func (r *Rule) genFunc(out io.Writer, prefix string) {
+	ruleName = r.Name
+	skipping = hasSkip && !IsLexical(r.Name)
+
+	fmt.Fprintf(out, "func (__p *parser) %s%s() (__ret interface{}, __err error) {\n", prefix, r.Name)
+	fmt.Fprintln(out, "__p.enter()")
+	fmt.Fprintln(out, "defer __p.leave()")
+
+	if Profile {
+		fmt.Fprintf(out, "defer __p.leaveRule(__p.enterRule(__peg_rule_%s), &__err)\n", r.Name)
+	}
+
+	if Memoize {
+		// recognizers have their own entries
+		key := "__peg_rule_" + r.Name
+		if prefix != "rule_" {
+			key += " + __peg_numRules"
+		}
+		key += ", __p.n"
+		restore := ""
+		if stateful {
+			// results depend on parser state
+			key += ", __p.stateID"
+			restore = "	__p.restoreState(m.state)\n"
+		}
+		fmt.Fprintf(out,
+			"if m, ok := __p.memo[memoKey{%s}]; ok {\n"+
+				"	__p.n = m.end\n"+
+				"	if m.far > __p.far {\n"+
+				"		__p.far = m.far\n"+
+				"	}\n"+
+				"	__p.errs = append(__p.errs, m.errs...)\n"+
+				"%s"+
+				"	return m.ret, m.err\n"+
+				"}\n"+
+				"defer __p.memoize(memoKey{%s}, len(__p.errs), __p.far, &__ret, &__err)\n"+
+				"__p.far = __p.n\n",
+			key, restore, key,
+		)
+	}
 
 	r.ChoiceExpr.GenCode(out)
 
 	fmt.Fprintln(out, "return nil, pegErr")
 
-	fmt.Fprintln(out, "}\n")
+	fmt.Fprint(out, "}\n\n")
 }
 
 func (ce *ChoiceExpr) GenCode(out io.Writer) {
+	if lits := ce.literals(); lits != nil {
+		if skipping {
+			fmt.Fprintln(out, "__p.skip()")
+		}
+		genLiterals(out, lits)
+		return
+	}
+
 	fmt.Fprintln(out, "__peg_n := __p.n")
+	if recovery {
+		fmt.Fprintln(out, "__peg_e := len(__p.errs)")
+	}
+	if stateful {
+		fmt.Fprintln(out, "__peg_s := __p.saveState()")
+	}
+	catch := ce.hasRecoverAlt()
+	if catch {
+		fmt.Fprintln(out, "__p.thrown = nil")
+	}
 	for _, ae := range ce.ActionExprs {
 		fmt.Fprintf(out, "if __ae_ret, err := ")
-		ae.GenCode(out)
-		fmt.Fprintf(out,
+		if catch && !ae.isRecover() {
+			fmt.Fprint(out, "__p.catch(")
+			ae.genFunc(out)
+			fmt.Fprint(out, ")")
+		} else {
+			ae.GenCode(out)
+		}
+		fmt.Fprint(out,
 			"; err == nil {\n"+
 				"	return __ae_ret, nil\n"+
-				"} else {\n"+
-				"	__p.backTo(__peg_n)"+
+				"} else {\n",
+		)
+		if Profile {
+			fmt.Fprintln(out, "	__p.stats[__p.rule].Backtracks++")
+		}
+		if recovery {
+			fmt.Fprintln(out, "	__p.errs = __p.errs[:__peg_e]")
+		}
+		if stateful {
+			fmt.Fprintln(out, "	__p.restoreState(__peg_s)")
+		}
+		fmt.Fprint(out,
+			"	__p.backTo(__peg_n)"+
 				"}\n",
 		)
 	}
 }
 
+// literals returns the strings if every alternative of ce is a literal
+// string without label, operator or action.
+func (ce *ChoiceExpr) literals() []string {
+	if len(ce.ActionExprs) < 2 || TokenInput {
+		return nil
+	}
+	lits := []string{}
+	for _, ae := range ce.ActionExprs {
+		if ae.Code != "" || len(ae.SeqExpr.LabeledExprs) != 1 {
+			return nil
+		}
+		le := ae.SeqExpr.LabeledExprs[0]
+		if le.Label != "" || le.PrefixedExpr.PrefixOp != 0 || le.PrefixedExpr.SuffixedExpr.SuffixOp != 0 {
+			return nil
+		}
+		m, ok := le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(*LitMatcher)
+		if !ok || m.Lit == "" {
+			return nil
+		}
+		lits = append(lits, m.Lit)
+	}
+	return lits
+}
+
+// genLiterals writes a choice of literals dispatched on the first character.
+// Literals with the same first character are tried in order.
+func genLiterals(out io.Writer, lits []string) {
+	firsts := []rune{}
+	groups := map[rune][]string{}
+	for _, lit := range lits {
+		r, _ := utf8.DecodeRuneInString(lit)
+		if _, ok := groups[r]; !ok {
+			firsts = append(firsts, r)
+		}
+		groups[r] = append(groups[r], lit)
+	}
+
+	fmt.Fprintln(out, "if __p.n < len(__p.src) {")
+	fmt.Fprintln(out, "switch __p.src[__p.n] {")
+	for _, r := range firsts {
+		fmt.Fprintf(out, "case %s:\n", strconv.QuoteRune(r))
+		for _, lit := range groups[r] {
+			l := utf8.RuneCountInString(lit)
+			fmt.Fprintf(out, "if __p.hasString(%q, %d) {\n", lit, l)
+			if advance {
+				fmt.Fprintf(out, "	__p.advance(%d)\n", l)
+			}
+			if discard {
+				fmt.Fprintln(out, "	return nil, nil")
+			} else {
+				fmt.Fprintf(out, "	return %q, nil\n", lit)
+			}
+			fmt.Fprintln(out, "}")
+		}
+	}
+	fmt.Fprintln(out, "}")
+	fmt.Fprintln(out, "}")
+}
+
+// recovery is true if the grammar has %recover, which needs recovered errors
+// to be dropped on backtracking.
+var recovery = false
+
+func (ce *ChoiceExpr) hasRecover() bool {
+	for _, ae := range ce.ActionExprs {
+		for _, le := range ae.SeqExpr.LabeledExprs {
+			switch pe := le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(type) {
+			case *RecoverExpr:
+				return true
+			case *SubExpr:
+				if pe.ChoiceExpr.hasRecover() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (ae *ActionExpr) isRecover() bool {
+	_, ok := ae.SeqExpr.LabeledExprs[0].PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(*RecoverExpr)
+	return ok
+}
+
+// hasRecoverAlt reports whether an alternative of ce starts with %recover,
+// which catches errors raised by other alternatives.
+func (ce *ChoiceExpr) hasRecoverAlt() bool {
+	for _, ae := range ce.ActionExprs {
+		if ae.isRecover() {
+			return true
+		}
+	}
+	return false
+}
+
+func (ce *ChoiceExpr) hasCode() bool {
+	for _, ae := range ce.ActionExprs {
+		if ae.Code != "" {
+			return true
+		}
+		for _, le := range ae.SeqExpr.LabeledExprs {
+			sub, ok := le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(*SubExpr)
+			if ok && sub.ChoiceExpr.hasCode() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasPredicate reports whether ae has a semantic predicate or state code.
+func (ae *ActionExpr) hasPredicate() bool {
+	for _, le := range ae.SeqExpr.LabeledExprs {
+		switch le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(type) {
+		case *CodeExpr, *StateCodeExpr:
+			return true
+		}
+	}
+	return false
+}
+
+// indentation is true if the grammar has INDENT, DEDENT or SAMEDENT, whose
+// stack is kept in parser state.
+var indentation = false
+
+func (ce *ChoiceExpr) hasIndent() bool {
+	for _, ae := range ce.ActionExprs {
+		for _, le := range ae.SeqExpr.LabeledExprs {
+			switch pe := le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(type) {
+			case *IndentExpr:
+				return true
+			case *SubExpr:
+				if pe.ChoiceExpr.hasIndent() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// stateful is true if the grammar has %state or indentation, whose changes are undone on
+// backtracking.
+var stateful = false
+
 func (se *SeqExpr) hasLabel() bool {
 	for _, le := range se.LabeledExprs {
 		if le.Label != "" {
@@ -232,13 +1287,35 @@ var userCodeN uint64 = 0
 var userCode = &bytes.Buffer{}
 
 func (ae *ActionExpr) GenCode(out io.Writer) {
+	ae.genFunc(out)
+	fmt.Fprint(out, "()")
+}
+
+func (ae *ActionExpr) genFunc(out io.Writer) {
 	fmt.Fprint(out, "func() (interface{}, error) {\n")
 
+	// value of ae is not used, and no code uses values of ae's exprs
+	discardValue := discard && ae.Code == "" && !ae.hasPredicate()
+	defer func(d bool) {
+		discard = d
+	}(discard)
+
 	vars := []string{}
 	hasLabel := ae.SeqExpr.hasLabel()
+	throwMsg := "" // message of a ^ right before le
 	for n, le := range ae.SeqExpr.LabeledExprs {
+		msg := throwMsg
+		throwMsg = ""
+
+		scope := []string{} // labels before le
+		if hasLabel {
+			scope = append(scope, vars...)
+		}
+
 		var varName string
-		if !hasLabel {
+		if discardValue {
+			varName = "_"
+		} else if !hasLabel {
 			varName = fmt.Sprintf("__peg_v%d", n)
 		} else if le.Label != "" {
 			varName = le.Label
@@ -251,81 +1328,162 @@ func (ae *ActionExpr) GenCode(out io.Writer) {
 			fmt.Fprintf(out, "var %s interface{}\n", varName)
 		}
 
-		var retVarName string
-		not := "="
-		if le.PrefixedExpr.PrefixOp == AND || le.PrefixedExpr.PrefixOp == NOT {
-			retVarName = "_"
+		if sc, ok := le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(*StateCodeExpr); ok {
+			fmt.Fprintln(out, "__p.stateChanged()")
+			fmt.Fprintln(out, genStateCode(sc.Code, scope, scope))
+			continue
+		}
+
+		if ce, ok := le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(*CodeExpr); ok {
+			not := ""
 			if le.PrefixedExpr.PrefixOp == NOT {
 				not = "!"
 			}
-		} else if varName == "_" {
-			retVarName = "_"
+			fmt.Fprintf(out, "if %s%s {\n", not, genPredicate(ce.Code, scope, scope))
 		} else {
-			retVarName = "__pe_ret"
-		}
+			var retVarName string
+			not := "="
+			if le.PrefixedExpr.PrefixOp == AND || le.PrefixedExpr.PrefixOp == NOT {
+				retVarName = "_"
+				if le.PrefixedExpr.PrefixOp == NOT {
+					not = "!"
+				}
+			} else if varName == "_" {
+				retVarName = "_"
+			} else {
+				retVarName = "__pe_ret"
+			}
 
-		fmt.Fprintf(out, "if %s, err := ", retVarName)
+			fmt.Fprintf(out, "if %s, err := ", retVarName)
 
-		le.PrefixedExpr.GenCode(out)
+			discard = retVarName == "_"
+			le.PrefixedExpr.GenCode(out)
 
-		fmt.Fprintf(out, "; err %s= nil {\n", not)
-		if retVarName != "_" {
-			fmt.Fprintf(out, "	%s = %s\n", varName, retVarName)
+			fmt.Fprintf(out, "; err %s= nil {\n", not)
+			if retVarName != "_" {
+				fmt.Fprintf(out, "	%s = %s\n", varName, retVarName)
+			}
+		}
+		fmt.Fprintln(out, "} else {")
+		if msg != "" {
+			fmt.Fprintf(out, "	__p.throw(%q, %q)\n", ruleName, msg)
 		}
 		fmt.Fprint(out,
-			"} else {\n"+
-				"	return nil, pegErr\n"+
+			"	return nil, pegErr\n"+
 				"}\n",
 		)
-	}
 
-	if ae.Code != "" {
-		var paramsDef string
-		var paramsCall string
-		if hasLabel {
-			paramsDef = fmt.Sprintf("%s interface{}", strings.Join(vars, ", "))
-			paramsCall = strings.Join(vars, ", ")
-		} else {
-			if len(vars) == 1 {
-				paramsDef = fmt.Sprintf("result interface{}")
-				paramsCall = fmt.Sprintf("%s", vars[0])
-			} else {
-				paramsDef = fmt.Sprintf("result [%d]interface{}", len(vars))
-				paramsCall = fmt.Sprintf("[...]interface{}{%s}", strings.Join(vars, ", "))
-			}
+		if te, ok := le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(*ThrowExpr); ok {
+			throwMsg = te.Msg
 		}
+	}
 
-		userCode.WriteString(
-			fmt.Sprintf(
-				"func (__p *parser) ae_code_%d(%s) (ret interface{}) {\n"+
-					"	%s\n"+
-					"	return\n"+
-					"}\n",
-				userCodeN,
-				paramsDef,
-				ae.Code,
-			),
-		)
+	if discardValue {
+		fmt.Fprintln(out, "return nil, nil")
+	} else {
+		fmt.Fprintf(out, "return %s, nil\n", ae.genValue(vars, vars))
+	}
 
-		fmt.Fprintf(out, "return __p.ae_code_%d(%s), nil\n",
-			userCodeN,
-			paramsCall,
-		)
+	fmt.Fprint(out, "}")
+}
+
+// genValue returns the expression of the value of ae, where args are the
+// values of params. Action code goes to userCode.
+func (ae *ActionExpr) genValue(params, args []string) string {
+	if ae.Code == "" {
+		if len(args) > 1 {
+			return fmt.Sprintf("[...]interface{}{%s}", strings.Join(args, ", "))
+		} else {
+			return args[0]
+		}
+	}
 
-		userCodeN++
+	var paramsDef string
+	var paramsCall string
+	if ae.SeqExpr.hasLabel() {
+		paramsDef = fmt.Sprintf("%s interface{}", strings.Join(params, ", "))
+		paramsCall = strings.Join(args, ", ")
 	} else {
-		if len(vars) > 1 {
-			fmt.Fprintf(out, "return [...]interface{}{%s}, nil\n", strings.Join(vars, ", "))
+		if len(args) == 1 {
+			paramsDef = fmt.Sprintf("result interface{}")
+			paramsCall = fmt.Sprintf("%s", args[0])
 		} else {
-			fmt.Fprintf(out, "return %s, nil\n", vars[0])
+			paramsDef = fmt.Sprintf("result [%d]interface{}", len(args))
+			paramsCall = fmt.Sprintf("[...]interface{}{%s}", strings.Join(args, ", "))
 		}
 	}
 
-	fmt.Fprint(out, "}()")
+	userCode.WriteString(
+		fmt.Sprintf(
+			"func (__p *parser) ae_code_%d(%s) (ret interface{}) {\n"+
+				"	%s\n"+
+				"	return\n"+
+				"}\n",
+			userCodeN,
+			paramsDef,
+			ae.Code,
+		),
+	)
+
+	call := fmt.Sprintf("__p.ae_code_%d(%s)", userCodeN, paramsCall)
+	userCodeN++
+	return call
+}
+
+// genPredicate returns the call of semantic predicate code, where args are
+// the values of labels params. Code goes to userCode.
+func genPredicate(code string, params, args []string) string {
+	paramsDef := ""
+	if len(params) > 0 {
+		paramsDef = fmt.Sprintf("%s interface{}", strings.Join(params, ", "))
+	}
+
+	userCode.WriteString(
+		fmt.Sprintf(
+			"func (__p *parser) pred_code_%d(%s) (ok bool) {\n"+
+				"	%s\n"+
+				"	return\n"+
+				"}\n",
+			userCodeN,
+			paramsDef,
+			code,
+		),
+	)
+
+	call := fmt.Sprintf("__p.pred_code_%d(%s)", userCodeN, strings.Join(args, ", "))
+	userCodeN++
+	return call
+}
+
+// genStateCode returns the call of state code, where args are the values of
+// labels params. Code goes to userCode.
+func genStateCode(code string, params, args []string) string {
+	paramsDef := "state *parserState"
+	if len(params) > 0 {
+		paramsDef += fmt.Sprintf(", %s interface{}", strings.Join(params, ", "))
+	}
+
+	userCode.WriteString(
+		fmt.Sprintf(
+			"func (__p *parser) state_code_%d(%s) {\n"+
+				"	%s\n"+
+				"}\n",
+			userCodeN,
+			paramsDef,
+			code,
+		),
+	)
+
+	call := fmt.Sprintf("__p.state_code_%d(%s)", userCodeN, strings.Join(append([]string{"&__p.state"}, args...), ", "))
+	userCodeN++
+	return call
 }
 
 var advance = true
 
+// discard is true when generating an expression whose value is not used.
+var discard = false
+
 func (pe *PrefixedExpr) GenCode(out io.Writer) {
 	fmt.Fprintln(out, "func() (interface{}, error) {")
 
@@ -335,6 +1493,13 @@ func (pe *PrefixedExpr) GenCode(out io.Writer) {
 			advance = true
 		}()
 	}
+	if pe.PrefixOp == AND || pe.PrefixOp == NOT {
+		// rules and skip consume input even if advance is false
+		fmt.Fprintln(out, "defer func(n int) { __p.n = n }(__p.n)")
+	}
+	if stateful && (pe.PrefixOp == AND || pe.PrefixOp == NOT) {
+		fmt.Fprintln(out, "defer __p.restoreState(__p.saveState())")
+	}
 
 	if pe.SuffixedExpr.SuffixOp != 0 {
 		fmt.Fprint(out, "// PrefixedExpr: ")
@@ -348,13 +1513,25 @@ func (pe *PrefixedExpr) GenCode(out io.Writer) {
 				"}",
 		)
 
+		if stateful {
+			fmt.Fprintln(out, "__peg_pe = __p.undoable(__peg_pe)")
+		}
+
 		switch pe.SuffixedExpr.SuffixOp {
 		case QUESTION: // 0-1
 			fmt.Fprintf(out, "return __p.zeroOrOne(__peg_pe)\n")
 		case PLUS: // 1-
-			fmt.Fprintf(out, "return __p.oneOrMore(__peg_pe)\n")
+			if discard {
+				fmt.Fprintf(out, "return __p.skipOneOrMore(__peg_pe)\n")
+			} else {
+				fmt.Fprintf(out, "return __p.oneOrMore(__peg_pe)\n")
+			}
 		case STAR: // 0-
-			fmt.Fprintf(out, "return __p.zeroOrMore(__peg_pe)\n")
+			if discard {
+				fmt.Fprintf(out, "return __p.skipZeroOrMore(__peg_pe)\n")
+			} else {
+				fmt.Fprintf(out, "return __p.zeroOrMore(__peg_pe)\n")
+			}
 		}
 	} else {
 		pe.SuffixedExpr.PrimaryExpr.GenCode(out)
@@ -368,54 +1545,167 @@ func (pe *PrimaryExpr) GenCode(out io.Writer) {
 	pe.Print(out)
 	fmt.Fprintln(out, "")
 
-	switch pe.PrimaryExpr.(type) {
-	case *Matcher:
-		pe.PrimaryExpr.(*Matcher).GenCode(out)
-	case string:
-		fmt.Fprintf(out,
-			"return __p.rule_%s()\n",
-			pe.PrimaryExpr.(string))
-	case *ChoiceExpr:
-		pe.PrimaryExpr.(*ChoiceExpr).GenCode(out)
+	switch e := pe.Expr.(type) {
+	case *LitMatcher, *ClassMatcher, *AnyMatcher, *KindMatcher:
+		if skipping {
+			fmt.Fprintln(out, "__p.skip()")
+		}
+		genMatcher(out, e)
+	case *RuleRef:
+		if skipping && IsLexical(e.Name) {
+			fmt.Fprintln(out, "__p.skip()")
+		}
+		f := "rule_" + e.Name
+		if discard {
+			if skip := recognizer(e.Name); skip != "" {
+				f = skip
+			}
+		}
+		fmt.Fprintf(out, "return __p.%s()\n", f)
+	case *SubExpr:
+		e.ChoiceExpr.GenCode(out)
+	case *RecoverExpr:
+		sync := "rule_" + e.Rule
+		if skip := recognizer(e.Rule); skip != "" {
+			sync = skip
+		}
+		fmt.Fprintf(out, "return __p.recoverWith(%q, __p.%s)\n", ruleName, sync)
+	case *ThrowExpr:
+		fmt.Fprintln(out, "return nil, nil")
+	case *IndentExpr:
+		switch e.Type {
+		case INDENT:
+			fmt.Fprintf(out, "return __p.indent(%t)\n", advance)
+		case DEDENT:
+			fmt.Fprintf(out, "return __p.dedent(%q)\n", ruleName)
+		case SAMEDENT:
+			fmt.Fprintf(out, "return __p.samedent(%t)\n", advance)
+		}
 	default:
-		panic("type of PrimaryExpr should be *Matcher, string, *ChoiceExpr")
+		panic(fmt.Sprintf("Expr of PrimaryExpr should be a matcher, *RuleRef, *SubExpr, *RecoverExpr, *ThrowExpr, *IndentExpr, not %T", e))
 	}
 }
 
-func serializeCharRange(chars []*Char) string {
-	buf := &bytes.Buffer{}
-	for _, c := range chars {
-		buf.WriteString(strconv.QuoteRune(c.Start))
-		buf.WriteString(", ")
-		buf.WriteString(strconv.QuoteRune(c.End))
-		buf.WriteString(", ")
+var classN uint64 = 0
+var classTables = &bytes.Buffer{}
+
+func isASCII(cr *CharRange) bool {
+	for _, c := range cr.Chars {
+		if c.End >= utf8.RuneSelf {
+			return false
+		}
 	}
-	return buf.String()
+	return true
 }
 
-func (m *Matcher) GenCode(out io.Writer) {
-	switch m.Matcher.(type) {
-	case int:
-		fmt.Fprintf(out,
-			"return __p.expectDot(%t)\n",
-			advance)
-	case string:
-		str := m.Matcher.(string)
-		l := utf8.RuneCountInString(str)
-		fmt.Fprintf(out,
-			"return __p.expectString(%t, %q, %d)\n",
-			advance, str, l)
-	case *CharRange:
-		funcName := "expectChar"
-		if m.Matcher.(*CharRange).Not {
-			funcName = "expectCharNot"
+// genCharRange writes a matcher of cr, a bitmap lookup if cr is ASCII only,
+// or a switch otherwise.
+func genCharRange(out io.Writer, cr *CharRange) {
+	if len(cr.Chars) == 0 && !cr.Not {
+		// matches nothing, falling through to the failure after the matcher
+		fmt.Fprintln(out, "// empty character class")
+		return
+	}
+
+	fmt.Fprintln(out, "if __p.n < len(__p.src) {")
+
+	if isASCII(cr) {
+		var bitmap [2]uint64
+		for _, c := range cr.Chars {
+			for r := c.Start; r <= c.End; r++ {
+				bitmap[r>>6] |= 1 << uint(r&63)
+			}
 		}
-		fmt.Fprintf(out,
-			"return __p.%s(%t, %s)\n",
-			funcName,
-			advance, serializeCharRange(m.Matcher.(*CharRange).Chars),
-		)
+		fmt.Fprintf(classTables, "var __peg_class%d = [2]uint64{%#x, %#x}\n", classN, bitmap[0], bitmap[1])
+
+		not := ""
+		if cr.Not {
+			not = "!"
+		}
+		fmt.Fprintln(out, "c := __p.src[__p.n]")
+		fmt.Fprintf(out, "if %s(c < 128 && __peg_class%d[c>>6]&(1<<uint(c&63)) != 0) {\n", not, classN)
+		classN++
+	} else {
+		conds := []string{}
+		for _, c := range cr.Chars {
+			if c.Start == c.End {
+				conds = append(conds, fmt.Sprintf("c == %s", strconv.QuoteRune(c.Start)))
+			} else {
+				conds = append(conds, fmt.Sprintf("%s <= c && c <= %s", strconv.QuoteRune(c.Start), strconv.QuoteRune(c.End)))
+			}
+		}
+		fmt.Fprintln(out, "switch c := __p.src[__p.n]; {")
+		if len(conds) > 0 {
+			fmt.Fprintf(out, "case %s:\n", strings.Join(conds, ", "))
+		}
+		if cr.Not {
+			fmt.Fprintln(out, "default:")
+		}
+	}
+
+	if advance {
+		fmt.Fprintln(out, "	__p.advance(1)")
+	}
+	if discard {
+		fmt.Fprintln(out, "	return nil, nil")
+	} else {
+		fmt.Fprintln(out, "	return string(c), nil")
+	}
+	fmt.Fprintln(out, "}")
+
+	fmt.Fprintln(out, "}")
+}
+
+// genMatcher generates the matcher m.
+func genMatcher(out io.Writer, m Expr) {
+	if TokenInput {
+		genTokenMatcher(out, m)
+		return
+	}
+
+	switch m := m.(type) {
+	case *AnyMatcher:
+		if discard {
+			fmt.Fprintln(out, "if __p.n < len(__p.src) {")
+			if advance {
+				fmt.Fprintln(out, "	__p.advance(1)")
+			}
+			fmt.Fprintln(out, "	return nil, nil\n}")
+		} else {
+			fmt.Fprintf(out,
+				"return __p.expectDot(%t)\n",
+				advance)
+		}
+	case *LitMatcher:
+		l := utf8.RuneCountInString(m.Lit)
+		if discard {
+			fmt.Fprintf(out, "if __p.hasString(%q, %d) {\n", m.Lit, l)
+			if advance {
+				fmt.Fprintf(out, "	__p.advance(%d)\n", l)
+			}
+			fmt.Fprintln(out, "	return nil, nil\n}")
+		} else {
+			fmt.Fprintf(out,
+				"return __p.expectString(%t, %q, %d)\n",
+				advance, m.Lit, l)
+		}
+	case *ClassMatcher:
+		genCharRange(out, m.Class)
+	default:
+		panic(fmt.Sprintf("matcher should be *AnyMatcher, *LitMatcher, *ClassMatcher, not %T", m))
+	}
+}
+
+// genTokenMatcher generates m matching a token in token input mode.
+func genTokenMatcher(out io.Writer, m Expr) {
+	switch m := m.(type) {
+	case *AnyMatcher:
+		fmt.Fprintf(out, "return __p.expectDot(%t)\n", advance)
+	case *LitMatcher:
+		fmt.Fprintf(out, "return __p.expectText(%t, %q)\n", advance, m.Lit)
+	case *KindMatcher:
+		fmt.Fprintf(out, "return __p.expectKind(%t, %q)\n", advance, m.Kind)
 	default:
-		panic("type of Matcher should be int, string, *CharRange")
+		panic(fmt.Sprintf("matcher should be *AnyMatcher, *LitMatcher, *KindMatcher, not %T", m))
 	}
 }
@@ -0,0 +1,134 @@
+package peg_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+	"github.com/laurence6/PEG.go/internal/gentest"
+)
+
+// parseMain prints the result of Parse of its argument, or the error.
+const parseMain = `package main
+
+import (
+	"fmt"
+	"os"
+
+	"gentest/parser"
+)
+
+func main() {
+	v, err := parser.Parse([]rune(os.Args[1]))
+	if err != nil {
+		fmt.Print("error: ", err)
+		return
+	}
+	fmt.Print(v)
+}
+`
+
+func TestEmptyCharRange(t *testing.T) {
+	tree, err := peg.ReadTree(strings.NewReader(`
+package p
+
+import "bytes"
+import "errors"
+import "fmt"
+import "reflect"
+
+A = [] / [^]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bin := gentest.Build(t, tree, parseMain)
+	for in, want := range map[string]string{"x": "x", "é": "é"} {
+		out, err := exec.Command(bin, in).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != want {
+			t.Errorf("Parse(%q) = %s, want %s", in, out, want)
+		}
+	}
+}
+
+func TestThrowNextItem(t *testing.T) {
+	tree, err := peg.ReadTree(strings.NewReader(`
+package p
+
+import "bytes"
+import "errors"
+import "fmt"
+import "reflect"
+
+S = "(" "x" ^"missing closing paren" ")" ";"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bin := gentest.Build(t, tree, parseMain)
+	for in, want := range map[string]string{
+		"(x;": "error: 1:3: missing closing paren",
+		"(x)": "error: PEG ERROR",
+	} {
+		out, err := exec.Command(bin, in).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != want {
+			t.Errorf("Parse(%q) = %s, want %s", in, out, want)
+		}
+	}
+}
+
+func TestThrowOperator(t *testing.T) {
+	for _, g := range []string{
+		`S = ^"msg"* "x"`,
+		`S = ^"msg"? "x"`,
+		`S = !^"msg" "x"`,
+	} {
+		if _, err := peg.ReadTree(strings.NewReader(g)); err == nil || err.Error() != `^"msg" with operator` {
+			t.Errorf("ReadTree(%s): %v, want ^ with operator", g, err)
+		}
+	}
+}
+
+func TestIndentLineStart(t *testing.T) {
+	tree, err := peg.ReadTree(strings.NewReader(`
+package p
+
+import "bytes"
+import "errors"
+import "fmt"
+import "reflect"
+
+S = "a" SAMEDENT* INDENT? "b" { return "ok" }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bin := gentest.Build(t, tree, parseMain)
+	for in, want := range map[string]string{
+		"ab":       "ok",
+		"a\n\nb":   "ok",
+		"a \n b":   "ok",
+		"a b":      "error: PEG ERROR", // INDENT only after a line break
+		"a\n\t b":  "ok",
+		"a\n  \tb": "ok",
+	} {
+		cmd := exec.Command(bin, in)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != want {
+			t.Errorf("Parse(%q) = %s, want %s", in, out, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package peg
+
+import (
+	"fmt"
+	"io"
+)
+
+// Matcher is a matcher in the deprecated PrimaryExpr.PrimaryExpr.
+//
+// Deprecated: Use LitMatcher, ClassMatcher, AnyMatcher and KindMatcher.
+type Matcher struct {
+	Matcher interface{} // int(dot) / string / *CharRange / *TokenKind
+}
+
+// TokenKind is a token kind in the deprecated Matcher.
+//
+// Deprecated: Use KindMatcher.
+type TokenKind struct {
+	Kind string
+}
+
+// Expr returns the typed matcher of m.
+func (m *Matcher) Expr() Expr {
+	switch e := m.Matcher.(type) {
+	case int:
+		return &AnyMatcher{}
+	case string:
+		return &LitMatcher{e}
+	case *CharRange:
+		return &ClassMatcher{e}
+	case *TokenKind:
+		return &KindMatcher{e.Kind}
+	default:
+		panic(fmt.Sprintf("type of Matcher should be int, string, *CharRange, *TokenKind, not %T", e))
+	}
+}
+
+// GenCode generates the code of the typed matcher of m.
+//
+// Deprecated: Use GenCode of the typed matcher.
+func (m *Matcher) GenCode(out io.Writer) {
+	genMatcher(out, m.Expr())
+}
+
+// untyped returns e in the representation of the deprecated
+// PrimaryExpr.PrimaryExpr.
+func untyped(e Expr) interface{} {
+	switch e := e.(type) {
+	case *RuleRef:
+		return e.Name
+	case *LitMatcher:
+		return &Matcher{e.Lit}
+	case *ClassMatcher:
+		return &Matcher{e.Class}
+	case *AnyMatcher:
+		return &Matcher{0xd07}
+	case *KindMatcher:
+		return &Matcher{&TokenKind{e.Kind}}
+	case *SubExpr:
+		return e.ChoiceExpr
+	default:
+		return e
+	}
+}
+
+// typed returns the Expr of v in the representation of the deprecated
+// PrimaryExpr.PrimaryExpr.
+func typed(v interface{}) Expr {
+	switch e := v.(type) {
+	case string:
+		return &RuleRef{e}
+	case *Matcher:
+		return e.Expr()
+	case *ChoiceExpr:
+		return &SubExpr{e}
+	case Expr:
+		return e
+	default:
+		panic(fmt.Sprintf("type of PrimaryExpr should be *Matcher, string, *ChoiceExpr, *RecoverExpr, *ThrowExpr, *CodeExpr, *StateCodeExpr, *IndentExpr, not %T", e))
+	}
+}
+
+// Upgrade makes Expr and the deprecated PrimaryExpr.PrimaryExpr of each
+// PrimaryExpr in node agree. Expr is set from the deprecated field if the
+// field was assigned since they last agreed, as by code written before Expr
+// was added, and the field from Expr otherwise. A *Matcher changed in place
+// is not noticed. Check, Compile, the generators and Generate upgrade their
+// trees.
+func Upgrade(node Node) {
+	Inspect(node, func(n Node) bool {
+		if pe, ok := n.(*PrimaryExpr); ok {
+			pe.upgrade()
+		}
+		return true
+	})
+}
+
+func (pe *PrimaryExpr) upgrade() {
+	if pe.PrimaryExpr != nil && pe.PrimaryExpr != pe.synced {
+		pe.Expr = typed(pe.PrimaryExpr)
+		pe.syncedExpr, pe.synced = pe.Expr, pe.PrimaryExpr
+	} else if pe.Expr != nil && pe.Expr != pe.syncedExpr {
+		pe.sync()
+	}
+}
+
+// sync sets the deprecated field of pe from Expr.
+func (pe *PrimaryExpr) sync() {
+	pe.PrimaryExpr = untyped(pe.Expr)
+	pe.syncedExpr, pe.synced = pe.Expr, pe.PrimaryExpr
+}
@@ -0,0 +1,37 @@
+package peg_test
+
+import (
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+func TestUpgradeDeprecatedField(t *testing.T) {
+	tree, err := peg.ReadTree(strings.NewReader(`
+A = B
+B = "b"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe := tree.RuleList[0].ChoiceExpr.ActionExprs[0].SeqExpr.LabeledExprs[0].PrefixedExpr.SuffixedExpr.PrimaryExpr
+
+	// as by code written before Expr was added
+	pe.PrimaryExpr = "Nope"
+	if errs := peg.Check(tree); len(errs) == 0 {
+		t.Error("Check accepted a reference to an undefined rule")
+	}
+	if ref, ok := pe.Expr.(*peg.RuleRef); !ok || ref.Name != "Nope" {
+		t.Errorf("Expr = %#v, want reference to Nope", pe.Expr)
+	}
+
+	pe.Expr = &peg.LitMatcher{Lit: "a"}
+	peg.Upgrade(tree)
+	if m, ok := pe.PrimaryExpr.(*peg.Matcher); !ok || m.Matcher != "a" {
+		t.Errorf("PrimaryExpr = %#v, want matcher of \"a\"", pe.PrimaryExpr)
+	}
+	if errs := peg.Check(tree); len(errs) != 0 {
+		t.Error(errs)
+	}
+}
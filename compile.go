@@ -0,0 +1,287 @@
+package peg
+
+import (
+	"errors"
+	"fmt"
+)
+
+type compiler struct {
+	prog    *Program
+	rules   map[string]int // rule index
+	calls   []int          // OpCall to be patched with rule entry
+	strings map[string]int
+	actions []*CompiledAction
+	rule    string // current rule
+}
+
+// CompiledAction is an action or a semantic predicate of a Program.
+type CompiledAction struct {
+	*ActionExpr
+	Pred int // index of the semantic predicate in the sequence, or -1
+}
+
+// Compile compiles tree into a Program for the VM. Action i of the program
+// is the i-th CompiledAction returned.
+func (tree *Tree) Compile() (*Program, []*CompiledAction) {
+	Upgrade(tree)
+	c := &compiler{
+		prog: &Program{
+			Insts:   []Inst{},
+			Strings: []string{},
+			Classes: []*CharRange{},
+			Rules:   map[string]int{},
+		},
+		rules:   map[string]int{},
+		strings: map[string]int{},
+	}
+
+	if errs := CheckVM(tree); len(errs) > 0 {
+		panic(errs[0].Error())
+	}
+
+	for n, r := range tree.RuleList {
+		c.rules[r.Name] = n
+	}
+
+	c.emit(OpCall, c.rules[tree.RuleList[0].Name])
+	c.calls = append(c.calls, 0)
+	c.emit(OpEnd, 0)
+
+	for _, r := range tree.RuleList {
+		c.rule = r.Name
+		c.prog.Rules[r.Name] = len(c.prog.Insts)
+		c.choiceExpr(r.ChoiceExpr)
+		c.cover(c.block(CoverRule, r.Pos, r.End))
+		c.emit(OpReturn, 0)
+	}
+
+	for _, pc := range c.calls {
+		inst := &c.prog.Insts[pc]
+		inst.Arg = c.prog.Rules[tree.RuleList[inst.Arg].Name]
+	}
+
+	return c.prog, c.actions
+}
+
+// CheckVM returns an error for each feature of tree which the VM backend does
+// not support. Compile panics with the first.
+func CheckVM(tree *Tree) []error {
+	Upgrade(tree)
+	errs := []error{}
+	unsupported := func(rule, what string) {
+		if rule != "" {
+			what = fmt.Sprintf("Rule %q: %s", rule, what)
+		}
+		errs = append(errs, errors.New(what+" is not supported by the VM backend"))
+	}
+
+	if TokenInput {
+		unsupported("", "Token input")
+	}
+	if tree.Skip != nil {
+		unsupported("", "%skip")
+	}
+
+	rule := ""
+	Inspect(tree, func(n Node) bool {
+		switch n := n.(type) {
+		case *Rule:
+			rule = n.Name
+		case *ChoiceExpr:
+			return n != tree.Skip
+		case *RecoverExpr:
+			unsupported(rule, "%recover")
+		case *ThrowExpr:
+			unsupported(rule, "^")
+		case *StateCodeExpr:
+			unsupported(rule, "%{ }")
+		case *IndentExpr:
+			unsupported(rule, n.Type.String())
+		case *KindMatcher:
+			unsupported(rule, "@"+n.Kind)
+		}
+		return true
+	})
+
+	return errs
+}
+
+func (c *compiler) emit(op Op, arg int) int {
+	c.prog.Insts = append(c.prog.Insts, Inst{Op: op, Arg: arg})
+	return len(c.prog.Insts) - 1
+}
+
+func (c *compiler) here() int {
+	return len(c.prog.Insts)
+}
+
+// block adds a block of the current rule to Cover, or returns -1 unless
+// Coverage.
+func (c *compiler) block(kind CoverKind, pos, end Pos) int {
+	if !Coverage {
+		return -1
+	}
+	c.prog.Cover = append(c.prog.Cover, &CoverBlock{Kind: kind, Rule: c.rule, Pos: pos, End: end})
+	return len(c.prog.Cover) - 1
+}
+
+// cover counts a match of block.
+func (c *compiler) cover(block int) {
+	if block >= 0 {
+		c.emit(OpCover, block)
+	}
+}
+
+// patch sets jump target of inst at pc to the next instruction.
+func (c *compiler) patch(pc int) {
+	c.prog.Insts[pc].Arg = c.here()
+}
+
+func (c *compiler) choiceExpr(ce *ChoiceExpr) {
+	commits := []int{}
+	alt := func(ae *ActionExpr) {
+		c.actionExpr(ae)
+		if len(ce.ActionExprs) > 1 {
+			c.cover(c.block(CoverAlt, ae.Pos, ae.End))
+		}
+	}
+	for n, ae := range ce.ActionExprs {
+		if n == len(ce.ActionExprs)-1 {
+			alt(ae)
+			break
+		}
+		choice := c.emit(OpChoice, 0)
+		alt(ae)
+		commits = append(commits, c.emit(OpCommit, 0))
+		c.patch(choice)
+	}
+	for _, pc := range commits {
+		c.patch(pc)
+	}
+}
+
+func (c *compiler) actionExpr(ae *ActionExpr) {
+	for i, le := range ae.SeqExpr.LabeledExprs {
+		if _, ok := le.PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(*CodeExpr); ok {
+			// values of exprs before the predicate are on top
+			c.prefixed(le.PrefixedExpr.PrefixOp, func() {
+				c.prog.Insts = append(c.prog.Insts, Inst{Op: OpPredicate, Arg: len(c.actions), N: i})
+				c.actions = append(c.actions, &CompiledAction{ae, i})
+			})
+			continue
+		}
+		c.prefixedExpr(le.PrefixedExpr)
+	}
+
+	n := len(ae.SeqExpr.LabeledExprs)
+	if ae.Code == "" && n == 1 && !ae.SeqExpr.hasLabel() {
+		// the value of the only expression
+		return
+	}
+
+	c.prog.Insts = append(c.prog.Insts, Inst{Op: OpCapture, Arg: len(c.actions), N: n})
+	c.actions = append(c.actions, &CompiledAction{ae, -1})
+}
+
+func (c *compiler) prefixedExpr(pe *PrefixedExpr) {
+	c.prefixed(pe.PrefixOp, func() {
+		c.suffixedExpr(pe.SuffixedExpr)
+	})
+}
+
+// prefixed compiles e with prefix op.
+func (c *compiler) prefixed(op TokenType, e func()) {
+	switch op {
+	case AND:
+		choice := c.emit(OpChoice, 0)
+		e()
+		commit := c.emit(OpBackCommit, 0)
+		c.patch(choice)
+		c.emit(OpFail, 0)
+		c.patch(commit)
+		c.emit(OpPushNil, 0)
+	case NOT:
+		choice := c.emit(OpChoice, 0)
+		e()
+		c.emit(OpFailTwice, 0)
+		c.patch(choice)
+		c.emit(OpPushNil, 0)
+	default:
+		e()
+	}
+}
+
+func (c *compiler) suffixedExpr(se *SuffixedExpr) {
+	if se.SuffixOp == 0 {
+		c.primaryExpr(se.PrimaryExpr)
+		return
+	}
+
+	// repeated expression, counted for each match
+	block := c.block(CoverRepeat, se.Pos, se.End)
+	e := func() {
+		c.primaryExpr(se.PrimaryExpr)
+		c.cover(block)
+	}
+
+	switch se.SuffixOp {
+	case QUESTION: // 0-1
+		choice := c.emit(OpChoice, 0)
+		e()
+		commit := c.emit(OpCommit, 0)
+		c.patch(choice)
+		c.emit(OpPushNil, 0)
+		c.patch(commit)
+	case PLUS: // 1-
+		e()
+		c.emit(OpList, 0)
+		c.loop(e)
+	case STAR: // 0-
+		c.emit(OpPushList, 0)
+		c.loop(e)
+	}
+}
+
+// loop appends values of e to the list on top until it fails.
+func (c *compiler) loop(e func()) {
+	choice := c.emit(OpChoice, 0)
+	start := c.here()
+	e()
+	c.emit(OpAppend, 0)
+	c.emit(OpPartialCommit, start)
+	c.patch(choice)
+}
+
+func (c *compiler) primaryExpr(pe *PrimaryExpr) {
+	switch e := pe.Expr.(type) {
+	case *AnyMatcher:
+		c.emit(OpAny, 0)
+	case *LitMatcher:
+		n, ok := c.strings[e.Lit]
+		if !ok {
+			n = len(c.prog.Strings)
+			c.prog.Strings = append(c.prog.Strings, e.Lit)
+			c.strings[e.Lit] = n
+		}
+		c.emit(OpString, n)
+	case *ClassMatcher:
+		c.emit(OpChar, len(c.prog.Classes))
+		c.prog.Classes = append(c.prog.Classes, e.Class)
+	case *KindMatcher:
+		panic("token input is not supported by the VM backend")
+	case *RuleRef:
+		c.calls = append(c.calls, c.emit(OpCall, c.rules[e.Name]))
+	case *SubExpr:
+		c.choiceExpr(e.ChoiceExpr)
+	case *RecoverExpr:
+		panic("%recover is not supported by the VM backend")
+	case *ThrowExpr:
+		panic("^ is not supported by the VM backend")
+	case *StateCodeExpr:
+		panic("%{ } is not supported by the VM backend")
+	case *IndentExpr:
+		panic("INDENT, DEDENT and SAMEDENT are not supported by the VM backend")
+	default:
+		panic("Expr of PrimaryExpr should be a matcher, *RuleRef, *SubExpr")
+	}
+}
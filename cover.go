@@ -0,0 +1,162 @@
+package peg
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"sync/atomic"
+	"text/tabwriter"
+)
+
+// CoverKind is the kind of a CoverBlock.
+type CoverKind uint8
+
+const (
+	CoverRule   CoverKind = iota // rule
+	CoverAlt                     // alternative of a choice
+	CoverRepeat                  // expression of ?, * or +
+)
+
+func (k CoverKind) String() string {
+	switch k {
+	case CoverRule:
+		return "rule"
+	case CoverAlt:
+		return "alternative"
+	case CoverRepeat:
+		return "repetition"
+	}
+	return "Unknown"
+}
+
+// CoverBlock is a part of a grammar counting its matches, including matches
+// undone by backtracking. Pos and End are zero if the grammar was not read by
+// GetTree. Count is updated atomically, so that parses can run concurrently,
+// and should be read after they end.
+type CoverBlock struct {
+	Kind  CoverKind
+	Rule  string
+	Pos   Pos
+	End   Pos
+	Count int64
+}
+
+// ResetCover sets counts of blocks in prog.Cover to zero.
+func (prog *Program) ResetCover() {
+	for _, b := range prog.Cover {
+		atomic.StoreInt64(&b.Count, 0)
+	}
+}
+
+// WriteCoverText writes the count of each block and the percentage of blocks
+// matched. Blocks never matched are marked dead.
+func WriteCoverText(out io.Writer, blocks []*CoverBlock) {
+	w := tabwriter.NewWriter(out, 0, 8, 1, '\t', 0)
+	covered := 0
+	for _, b := range blocks {
+		dead := ""
+		if b.Count > 0 {
+			covered++
+		} else {
+			dead = "\tdead"
+		}
+		fmt.Fprintf(w, "%d:%d:\t%s\t%v\t%d%s\n", b.Pos.Line, b.Pos.Col, b.Rule, b.Kind, b.Count, dead)
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "coverage: %.1f%% of %d blocks\n", percent(covered, len(blocks)), len(blocks))
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+const coverStyle = `
+body { background: #fff; color: #000; }
+pre { font: 13px monospace; }
+.cov { background: #cfc; }
+.dead { background: #fcc; }
+`
+
+// WriteCoverHTML writes an HTML page with src, the grammar, in which blocks
+// matched are green and dead blocks red, like go tool cover.
+func WriteCoverHTML(out io.Writer, src string, blocks []*CoverBlock) {
+	text := []rune(src)
+
+	// offsets of lines, which end like in Scanner
+	lines := []int{0}
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				i++
+			}
+			fallthrough
+		case '\n':
+			lines = append(lines, i+1)
+		}
+	}
+	offset := func(p Pos) int {
+		if p.Line < 1 || p.Line > len(lines) {
+			return -1
+		}
+		if o := lines[p.Line-1] + p.Col - 1; o <= len(text) {
+			return o
+		}
+		return len(text)
+	}
+
+	// innermost block of each character, painting outer blocks first
+	sorted := make([]*CoverBlock, 0, len(blocks))
+	covered := 0
+	for _, b := range blocks {
+		if offset(b.Pos) >= 0 && offset(b.End) >= 0 {
+			sorted = append(sorted, b)
+		}
+		if b.Count > 0 {
+			covered++
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return offset(sorted[i].End)-offset(sorted[i].Pos) > offset(sorted[j].End)-offset(sorted[j].Pos)
+	})
+	inner := make([]*CoverBlock, len(text))
+	for _, b := range sorted {
+		for i := offset(b.Pos); i < offset(b.End); i++ {
+			inner[i] = b
+		}
+	}
+
+	fmt.Fprintln(out, "<!DOCTYPE html>")
+	fmt.Fprintln(out, "<html>\n<head>\n<meta charset=\"utf-8\">")
+	fmt.Fprintln(out, "<title>Grammar coverage</title>")
+	fmt.Fprintf(out, "<style>%s</style>\n", coverStyle)
+	fmt.Fprintln(out, "</head>\n<body>")
+	fmt.Fprintf(out, "<p>coverage: %.1f%% of %d blocks</p>\n", percent(covered, len(blocks)), len(blocks))
+	fmt.Fprint(out, "<pre>")
+
+	for i := 0; i < len(text); {
+		b := inner[i]
+		j := i + 1
+		for j < len(text) && inner[j] == b {
+			j++
+		}
+		s := html.EscapeString(string(text[i:j]))
+		if b == nil {
+			fmt.Fprint(out, s)
+		} else {
+			class := "cov"
+			if b.Count == 0 {
+				class = "dead"
+			}
+			fmt.Fprintf(out, "<span class=\"%s\" title=\"%s %v: %d\">%s</span>", class, b.Rule, b.Kind, b.Count, s)
+		}
+		i = j
+	}
+
+	fmt.Fprintln(out, "</pre>\n</body>\n</html>")
+}
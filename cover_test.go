@@ -0,0 +1,134 @@
+package peg_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+	"github.com/laurence6/PEG.go/internal/gentest"
+)
+
+const coverGrammar = `
+import "bytes"
+import "errors"
+import "fmt"
+import "reflect"
+
+List = Item ("," Item)*
+Item = [a-z]+
+`
+
+func TestCoverConcurrent(t *testing.T) {
+	tree, err := peg.ReadTree(strings.NewReader(coverGrammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peg.Coverage = true
+	defer func() { peg.Coverage = false }()
+	prog, _ := tree.Compile()
+
+	const parses = 1000
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < parses; j++ {
+				prog.RunRule("List", []rune("a,b,c"), nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, b := range prog.Cover {
+		if b.Kind == peg.CoverRule && b.Rule == "Item" && b.Count != 8*parses*3 {
+			t.Errorf("Item matched %d times, want %d", b.Count, 8*parses*3)
+		}
+	}
+
+	prog.ResetCover()
+	for _, b := range prog.Cover {
+		if b.Count != 0 {
+			t.Errorf("%s %v: count %d after ResetCover", b.Rule, b.Kind, b.Count)
+		}
+	}
+}
+
+// coverMain parses in goroutines with a parser generated with Coverage, and
+// prints the count of matches of rule Item, then the sum of counts after
+// ResetCoverage.
+const coverMain = `package main
+
+import (
+	"fmt"
+	"sync"
+
+	peg "github.com/laurence6/PEG.go"
+
+	"gentest/parser"
+)
+
+func main() {
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				parser.Parse([]rune("a,b,c"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, b := range parser.Coverage() {
+		if b.Kind == peg.CoverRule && b.Rule == "Item" {
+			fmt.Print(b.Count)
+		}
+	}
+	parser.ResetCoverage()
+	sum := int64(0)
+	for _, b := range parser.Coverage() {
+		sum += b.Count
+	}
+	fmt.Print(" ", sum)
+}
+`
+
+func TestCoverGenerated(t *testing.T) {
+	tree, err := peg.ReadTree(strings.NewReader(coverGrammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peg.Coverage = true
+	peg.VMBackend = true
+	defer func() {
+		peg.Coverage = false
+		peg.VMBackend = false
+	}()
+
+	bin := gentest.Build(t, tree, coverMain)
+	out, err := exec.Command(bin).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprint(8*1000*3, " ", 0); string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
+
+func TestCoverClosure(t *testing.T) {
+	peg.Coverage = true
+	defer func() {
+		peg.Coverage = false
+		if recover() == nil {
+			t.Error("GenerateParser did not abort with Coverage and the closure backend")
+		}
+	}()
+
+	peg.GenerateParser(strings.NewReader(coverGrammar), ioutil.Discard)
+}
@@ -0,0 +1,59 @@
+package peg_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+	"github.com/laurence6/PEG.go/internal/gentest"
+)
+
+// editMain makes random edits of an outline with Edit, and prints the results
+// of Parse which differ from those of a new Parser.
+const editMain = `package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"gentest/parser"
+)
+
+func main() {
+	r := rand.New(rand.NewSource(1))
+	src := []rune("a\n  b = 1\n  c\n    d\ne\n")
+	p := parser.NewParser(src)
+	p.Parse()
+	for i := 0; i < 5000; i++ {
+		start := r.Intn(len(src) + 1)
+		end := start + r.Intn(len(src)-start+1)%4
+		text := []rune{}
+		for n := r.Intn(4); n > 0; n-- {
+			text = append(text, []rune("ab=  \n")[r.Intn(6)])
+		}
+		p.Edit(start, end, text)
+		src = append(append(append([]rune{}, src[:start]...), text...), src[end:]...)
+
+		v, err := p.Parse()
+		want, wantErr := parser.NewParser(src).Parse()
+		if fmt.Sprint(v, err) != fmt.Sprint(want, wantErr) {
+			fmt.Printf("%q: %v %v, want %v %v\n", string(src), v, err, want, wantErr)
+		}
+	}
+}
+`
+
+func TestEdit(t *testing.T) {
+	peg.Memoize = true
+	defer func() { peg.Memoize = false }()
+	bin := gentest.Build(t, readGrammar(t, "testdata/outline.peg"), editMain)
+
+	out, err := exec.Command(bin).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := strings.TrimSpace(string(out)); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,629 @@
+package peg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Format is a notation of grammars for Export.
+type Format int
+
+const (
+	FormatPEG    Format = iota // PEG.go
+	FormatEBNF                 // W3C EBNF of the XML specification
+	FormatABNF                 // ABNF of RFC 5234, with case-sensitive strings of RFC 7405
+	FormatPigeon               // pigeon
+	FormatPEGjs                // PEG.js and Peggy
+	FormatPython               // PEG grammar of Python (pegen)
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatPEG:
+		return "PEG.go"
+	case FormatEBNF:
+		return "EBNF"
+	case FormatABNF:
+		return "ABNF"
+	case FormatPigeon:
+		return "pigeon"
+	case FormatPEGjs:
+		return "PEG.js"
+	case FormatPython:
+		return "Python PEG"
+	}
+	return "Unknown"
+}
+
+// ExportActions makes Export keep action code as comments in formats other
+// than PEG.go, which keeps all code.
+var ExportActions = false
+
+type exporter struct {
+	format   Format
+	rule     string   // current rule
+	comments []string // comments of the current alternative
+	warnings []error
+}
+
+// Export writes tree in format. Expressions without equivalent in format are
+// written as comments, and a warning is returned for each.
+func (tree *Tree) Export(out io.Writer, format Format) []error {
+	Upgrade(tree)
+	e := &exporter{format: format}
+
+	e.genHeader(out, tree)
+	for _, r := range tree.RuleList {
+		e.genRule(out, r)
+	}
+
+	if format == FormatABNF {
+		// rule names of ABNF are case-insensitive
+		names := map[string]string{}
+		for _, r := range tree.RuleList {
+			n := strings.ToLower(abnfName(r.Name))
+			if other, ok := names[n]; ok && other != r.Name {
+				e.warnings = append(e.warnings, errors.New(
+					fmt.Sprintf("Rules %q and %q have the same name in ABNF", other, r.Name),
+				))
+			}
+			names[n] = r.Name
+		}
+	}
+
+	return e.warnings
+}
+
+func (e *exporter) genHeader(out io.Writer, tree *Tree) {
+	if e.format == FormatPEG {
+		if tree.Package != "" {
+			fmt.Fprintf(out, "package %s\n\n", tree.Package)
+		}
+		for _, i := range tree.Import {
+			if i.Name != "" {
+				fmt.Fprintf(out, "import %s %s\n", i.Name, pegQuote(i.Path))
+			} else {
+				fmt.Fprintf(out, "import %s\n", pegQuote(i.Path))
+			}
+		}
+		if len(tree.Import) > 0 {
+			fmt.Fprintln(out)
+		}
+		if tree.Code != "" {
+			fmt.Fprintf(out, "{%s}\n\n", tree.Code)
+		}
+		if tree.State != "" {
+			fmt.Fprintf(out, "%%state {%s}\n\n", tree.State)
+		}
+		if tree.Skip != nil {
+			e.rule = "%skip"
+			fmt.Fprintf(out, "%%skip = %s\n\n", e.choiceExpr(tree.Skip))
+		}
+		return
+	}
+
+	if tree.Skip != nil {
+		e.warnings = append(e.warnings, errors.New(
+			fmt.Sprintf("%%skip has no equivalent in %v", e.format),
+		))
+	}
+	if ExportActions && tree.Code != "" {
+		e.comments = append(e.comments, "{"+tree.Code+"}")
+		e.genComments(out)
+		fmt.Fprint(out, "\n\n")
+	}
+}
+
+func (e *exporter) genRule(out io.Writer, r *Rule) {
+	e.rule = r.Name
+
+	first, rest := "%s = ", "\n\t/ "
+	switch e.format {
+	case FormatEBNF:
+		first, rest = "%s ::= ", "\n\t| "
+	case FormatPigeon:
+		first = "%s <- "
+	case FormatPython:
+		first, rest = "%s: ", "\n    | "
+		if len(r.ChoiceExpr.ActionExprs) > 1 {
+			first = "%s:\n    | "
+		}
+	}
+
+	fmt.Fprintf(out, first, e.name(r.Name))
+	for i, ae := range r.ChoiceExpr.ActionExprs {
+		if i > 0 {
+			fmt.Fprint(out, rest)
+		}
+		fmt.Fprint(out, e.actionExpr(ae))
+		e.genComments(out)
+	}
+	fmt.Fprint(out, "\n\n")
+}
+
+// genComments writes comments of the current alternative after it.
+func (e *exporter) genComments(out io.Writer) {
+	for _, c := range e.comments {
+		switch e.format {
+		case FormatABNF, FormatPython:
+			prefix := "; "
+			if e.format == FormatPython {
+				prefix = "# "
+			}
+			for i, line := range strings.Split(c, "\n") {
+				if i > 0 {
+					fmt.Fprint(out, "\n\t")
+				} else {
+					fmt.Fprint(out, " ")
+				}
+				fmt.Fprint(out, prefix+strings.TrimRight(line, " \t\r"))
+			}
+		default:
+			fmt.Fprintf(out, " /* %s */", strings.Replace(c, "*/", "* /", -1))
+		}
+	}
+	e.comments = nil
+}
+
+func (e *exporter) warn(what string) {
+	e.warnings = append(e.warnings, errors.New(
+		fmt.Sprintf("Rule %q: %s has no equivalent in %v", e.rule, what, e.format),
+	))
+}
+
+func (e *exporter) choiceExpr(ce *ChoiceExpr) string {
+	sep := " / "
+	if e.format == FormatEBNF || e.format == FormatPython {
+		sep = " | "
+	}
+
+	alts := []string{}
+	for _, ae := range ce.ActionExprs {
+		alts = append(alts, e.actionExpr(ae))
+	}
+	return strings.Join(alts, sep)
+}
+
+func (e *exporter) actionExpr(ae *ActionExpr) string {
+	s := e.seqExpr(ae.SeqExpr)
+	if ae.Code != "" {
+		if e.format == FormatPEG {
+			s += " {" + ae.Code + "}"
+		} else if ExportActions {
+			e.comments = append(e.comments, "{"+ae.Code+"}")
+		}
+	}
+	return s
+}
+
+func (e *exporter) seqExpr(se *SeqExpr) string {
+	items := []string{}
+	for _, le := range se.LabeledExprs {
+		if s := e.labeledExpr(le); s != "" {
+			items = append(items, s)
+		}
+	}
+	if len(items) == 0 {
+		if e.format == FormatPython {
+			e.warn("empty sequence")
+		}
+		return `""`
+	}
+	return strings.Join(items, " ")
+}
+
+func (e *exporter) labeledExpr(le *LabeledExpr) string {
+	s := e.prefixedExpr(le.PrefixedExpr)
+	if s == "" || le.Label == "" {
+		return s
+	}
+	switch e.format {
+	case FormatPEG, FormatPigeon, FormatPEGjs:
+		return le.Label + ":" + s
+	case FormatPython:
+		return le.Label + "=" + s
+	}
+	return s
+}
+
+func (e *exporter) prefixedExpr(pe *PrefixedExpr) string {
+	op := pe.PrefixOp.String()
+
+	if what := e.unsupported(pe); what != "" {
+		e.warn(what)
+		e.comments = append(e.comments, "omitted "+pegText(pe))
+		return ""
+	}
+
+	if code, ok := pe.SuffixedExpr.PrimaryExpr.Expr.(*CodeExpr); ok {
+		if e.format == FormatPigeon {
+			// predicates of pigeon return (bool, error)
+			return op + "{ return func() bool {" + code.Code + "}(), nil }"
+		}
+		return op + "{" + code.Code + "}"
+	}
+	s := e.suffixedExpr(pe.SuffixedExpr)
+	if s == "" || pe.PrefixOp == 0 {
+		return s
+	}
+	return op + s
+}
+
+// unsupported returns what in pe has no equivalent in the format, not
+// looking into subexpressions.
+func (e *exporter) unsupported(pe *PrefixedExpr) string {
+	if e.format == FormatPEG {
+		return ""
+	}
+
+	switch p := pe.SuffixedExpr.PrimaryExpr.Expr.(type) {
+	case *CodeExpr:
+		if e.format != FormatPigeon {
+			return "semantic predicate"
+		}
+	case *RecoverExpr:
+		return "%recover"
+	case *ThrowExpr:
+		return "^"
+	case *StateCodeExpr:
+		return "state code"
+	case *IndentExpr:
+		if e.format != FormatPython || p.Type == SAMEDENT {
+			return p.Type.String()
+		}
+	case *ClassMatcher:
+		if e.format == FormatPython {
+			return "character class"
+		}
+	case *KindMatcher:
+		if e.format == FormatPigeon || e.format == FormatPEGjs {
+			return "token kind"
+		}
+	case *AnyMatcher:
+		if e.format == FormatPython {
+			return "any character"
+		}
+	}
+
+	if pe.PrefixOp != 0 && (e.format == FormatEBNF || e.format == FormatABNF) {
+		return "predicate " + pe.PrefixOp.String()
+	}
+	return ""
+}
+
+func (e *exporter) suffixedExpr(se *SuffixedExpr) string {
+	s := e.primaryExpr(se.PrimaryExpr, se.SuffixOp != 0)
+	if s == "" || se.SuffixOp == 0 {
+		return s
+	}
+	if e.format == FormatABNF {
+		switch se.SuffixOp {
+		case QUESTION:
+			return "[" + s + "]"
+		case STAR:
+			return "*" + s
+		case PLUS:
+			return "1*" + s
+		}
+	}
+	return s + se.SuffixOp.String()
+}
+
+// primaryExpr returns pe, in parentheses if atomic and it is a sequence.
+func (e *exporter) primaryExpr(pe *PrimaryExpr, atomic bool) string {
+	switch p := pe.Expr.(type) {
+	case *LitMatcher:
+		return e.literal(p.Lit, atomic)
+	case *ClassMatcher:
+		return e.class(p.Class)
+	case *KindMatcher:
+		if e.format == FormatPEG {
+			return "@" + p.Kind
+		}
+		return e.name(p.Kind)
+	case *AnyMatcher:
+		return e.any()
+	case *RuleRef:
+		return e.name(p.Name)
+	case *SubExpr:
+		if s := e.choiceExpr(p.ChoiceExpr); s != `""` {
+			return "(" + s + ")"
+		}
+		return `""`
+	case *RecoverExpr:
+		return "%recover(" + p.Rule + ")"
+	case *ThrowExpr:
+		return "^" + pegQuote(p.Msg)
+	case *StateCodeExpr:
+		return "%{" + p.Code + "}"
+	case *IndentExpr:
+		return p.Type.String()
+	}
+	panic(fmt.Sprintf("unknown expression %T", pe.Expr))
+}
+
+// any returns the matcher of any character.
+func (e *exporter) any() string {
+	switch e.format {
+	case FormatEBNF:
+		return "[#x0-#x10FFFF]"
+	case FormatABNF:
+		return "%x0-10FFFF"
+	}
+	return "."
+}
+
+func (e *exporter) name(name string) string {
+	if e.format == FormatABNF {
+		return abnfName(name)
+	}
+	return name
+}
+
+// abnfName returns name with '_' replaced by '-', starting with a letter.
+func abnfName(name string) string {
+	n := strings.Replace(name, "_", "-", -1)
+	if n == "" || !unicode.IsLetter(rune(n[0])) {
+		n = "rule" + n
+	}
+	return n
+}
+
+func (e *exporter) literal(s string, atomic bool) string {
+	switch e.format {
+	case FormatPEG:
+		return pegQuote(s)
+	case FormatPigeon, FormatPython:
+		return strconv.Quote(s)
+	case FormatPEGjs:
+		return jsQuote(s)
+	}
+
+	// EBNF and ABNF have no escapes in strings
+	parts := []string{}
+	run := []rune{}
+	flush := func() {
+		if len(run) > 0 {
+			parts = append(parts, e.printable(string(run)))
+			run = run[:0]
+		}
+	}
+	for _, c := range s {
+		if c >= 0x20 && c < 0x7f && (c != '"' || e.format == FormatEBNF) {
+			run = append(run, c)
+		} else {
+			flush()
+			if e.format == FormatEBNF {
+				parts = append(parts, fmt.Sprintf("#x%X", c))
+			} else {
+				parts = append(parts, fmt.Sprintf("%%x%X", c))
+			}
+		}
+	}
+	flush()
+
+	if len(parts) == 0 {
+		return `""`
+	}
+	if len(parts) > 1 && atomic {
+		return "(" + strings.Join(parts, " ") + ")"
+	}
+	return strings.Join(parts, " ")
+}
+
+// printable quotes printable ASCII s in EBNF or ABNF.
+func (e *exporter) printable(s string) string {
+	if e.format == FormatABNF {
+		if strings.IndexFunc(s, unicode.IsLetter) >= 0 {
+			return `%s"` + s + `"`
+		}
+		return `"` + s + `"`
+	}
+
+	if !strings.Contains(s, `"`) {
+		return `"` + s + `"`
+	}
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	// both quotes
+	i := strings.Index(s, `"`)
+	return e.printable(s[:i+1]) + " " + e.printable(s[i+1:])
+}
+
+func (e *exporter) class(cr *CharRange) string {
+	switch e.format {
+	case FormatPEG:
+		return cr.String()
+	case FormatABNF:
+		return abnfClass(cr)
+	}
+
+	esc := func(c rune) string {
+		switch {
+		case c == ']' || c == '\\':
+			return `\` + string(c)
+		case unicode.IsPrint(c):
+			return string(c)
+		case e.format == FormatPEGjs:
+			q := jsQuote(string(c))
+			return q[1 : len(q)-1]
+		}
+		q := strconv.QuoteRune(c)
+		return q[1 : len(q)-1]
+	}
+	if e.format == FormatEBNF {
+		esc = func(c rune) string {
+			if c > 0x20 && c < 0x7f && !strings.ContainsRune(`]-^#`, c) {
+				return string(c)
+			}
+			return fmt.Sprintf("#x%X", c)
+		}
+	}
+
+	// a single '-' or a leading '^' is moved to the end
+	chars, last := "", ""
+	for _, c := range cr.Chars {
+		switch {
+		case c.Start == c.End && c.Start == '-' && e.format != FormatEBNF:
+			last += "-"
+		case c.Start == c.End && c.Start == '^' && chars == "" && e.format != FormatEBNF:
+			last = "^" + last
+		default:
+			chars += esc(c.Start)
+			if c.End != c.Start {
+				chars += "-" + esc(c.End)
+			}
+		}
+	}
+	if cr.Not {
+		return "[^" + chars + last + "]"
+	}
+	return "[" + chars + last + "]"
+}
+
+// abnfClass returns alternatives of ranges of code points in cr.
+func abnfClass(cr *CharRange) string {
+	ranges := [][2]rune{}
+	for _, c := range cr.Chars {
+		ranges = append(ranges, [2]rune{c.Start, c.End})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	merged := [][2]rune{}
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1]+1 {
+			if r[1] > merged[n-1][1] {
+				merged[n-1][1] = r[1]
+			}
+		} else {
+			merged = append(merged, r)
+		}
+	}
+
+	if cr.Not {
+		not := [][2]rune{}
+		next := rune(0)
+		for _, r := range merged {
+			if r[0] > next {
+				not = append(not, [2]rune{next, r[0] - 1})
+			}
+			next = r[1] + 1
+		}
+		if next <= unicode.MaxRune {
+			not = append(not, [2]rune{next, unicode.MaxRune})
+		}
+		merged = not
+	}
+
+	alts := []string{}
+	for _, r := range merged {
+		if r[0] == r[1] {
+			alts = append(alts, fmt.Sprintf("%%x%X", r[0]))
+		} else {
+			alts = append(alts, fmt.Sprintf("%%x%X-%X", r[0], r[1]))
+		}
+	}
+	if len(alts) == 1 {
+		return alts[0]
+	}
+	return "(" + strings.Join(alts, " / ") + ")"
+}
+
+// pegText returns pe in PEG.go.
+func pegText(pe *PrefixedExpr) string {
+	return (&exporter{format: FormatPEG}).prefixedExpr(pe)
+}
+
+// oneLine returns s with line breaks replaced with spaces and other
+// unprintable characters escaped, so that s fits in a line comment.
+func oneLine(s string) string {
+	buf := ""
+	for _, c := range s {
+		switch {
+		case c == '\n' || c == '\r':
+			buf += " "
+		case c == '\t' || unicode.IsPrint(c):
+			buf += string(c)
+		default:
+			q := strconv.QuoteRuneToASCII(c)
+			buf += q[1 : len(q)-1]
+		}
+	}
+	return buf
+}
+
+// Print writes r in PEG.go on one line, as in comments of generated code.
+func (r *Rule) Print(out io.Writer) {
+	e := &exporter{format: FormatPEG}
+	fmt.Fprint(out, oneLine(r.Name+" = "+e.choiceExpr(r.ChoiceExpr)))
+}
+
+// Print writes pe in PEG.go on one line.
+func (pe *PrefixedExpr) Print(out io.Writer) {
+	fmt.Fprint(out, oneLine(pegText(pe)))
+}
+
+// Print writes pe in PEG.go on one line.
+func (pe *PrimaryExpr) Print(out io.Writer) {
+	if code, ok := pe.Expr.(*CodeExpr); ok {
+		fmt.Fprint(out, oneLine("{"+code.Code+"}"))
+		return
+	}
+	fmt.Fprint(out, oneLine((&exporter{format: FormatPEG}).primaryExpr(pe, false)))
+}
+
+// pegQuote quotes s with escapes of the scanner.
+func pegQuote(s string) string {
+	buf := []rune{'"'}
+	for _, c := range s {
+		switch c {
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		case '"', '\\':
+			buf = append(buf, '\\', c)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(append(buf, '"'))
+}
+
+// jsQuote quotes s as a JavaScript string.
+func jsQuote(s string) string {
+	buf := `"`
+	for _, c := range s {
+		switch {
+		case c == '\n':
+			buf += `\n`
+		case c == '\r':
+			buf += `\r`
+		case c == '\t':
+			buf += `\t`
+		case c == '"' || c == '\\':
+			buf += `\` + string(c)
+		case c < 0x20 || c == 0x7f || c == 0x2028 || c == 0x2029:
+			buf += fmt.Sprintf(`\u%04X`, c)
+		case c > 0xffff && !unicode.IsPrint(c):
+			c1, c2 := utf16Surrogates(c)
+			buf += fmt.Sprintf(`\u%04X\u%04X`, c1, c2)
+		default:
+			buf += string(c)
+		}
+	}
+	return buf + `"`
+}
+
+func utf16Surrogates(c rune) (rune, rune) {
+	c -= 0x10000
+	return 0xd800 + (c>>10)&0x3ff, 0xdc00 + c&0x3ff
+}
@@ -0,0 +1,93 @@
+package peg_test
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+	"github.com/laurence6/PEG.go/internal/gentest"
+)
+
+func TestExportPigeonPredicates(t *testing.T) {
+	tree, err := peg.ReadTree(strings.NewReader(`
+A = n:[0-9] &{ return n == "1" } !{ return false } "x"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	if warnings := tree.Export(out, peg.FormatPigeon); len(warnings) > 0 {
+		t.Errorf("warnings: %v", warnings)
+	}
+	want := `A <- n:[0-9] &{ return func() bool { return n == "1" }(), nil } !{ return func() bool { return false }(), nil } "x"`
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestImportABNFProse(t *testing.T) {
+	tree, warnings, err := peg.ImportTree(strings.NewReader("word = \"a\" / <any word>\nword =/ \"x\"\n"), peg.FormatABNF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings: %v", warnings)
+	}
+
+	out := &bytes.Buffer{}
+	tree.Export(out, peg.FormatPEG)
+	if want := "word = [aA]\n\t/ !\"\"\n\t/ [xX]\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("got\n%s\nwant rule\n%s", out, want)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	tree, err := peg.ReadTree(strings.NewReader("A = \"\x00\" n:B* {\n\treturn n\n}\nB = &{ return true } \"b\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	tree.RuleList[0].Print(out)
+	if want := `A = "\x00" n:B* { 	return n }`; out.String() != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	out.Reset()
+	tree.RuleList[1].ChoiceExpr.ActionExprs[0].SeqExpr.LabeledExprs[0].PrefixedExpr.Print(out)
+	if want := `&{ return true }`; out.String() != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestImportGenCode(t *testing.T) {
+	for _, g := range []struct {
+		format   peg.Format
+		src      string
+		warnings int
+	}{
+		{peg.FormatABNF, "greeting = %s\"hi\" SP name\nname = 1*ALPHA\n", 0},
+		{peg.FormatPigeon, "{\npackage main\n}\nGreeting <- \"hi \" name:[a-z]i+ EOF { return name, nil }\nEOF <- !.\n", 1},
+	} {
+		tree, warnings, err := peg.ImportTree(strings.NewReader(g.src), g.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(warnings) != g.warnings {
+			t.Errorf("%v: warnings: %v", g.format, warnings)
+		}
+
+		out := &bytes.Buffer{}
+		tree.GenCode(out)
+		bin := gentest.BuildSource(t, out.String(), parseMain)
+		res, err := exec.Command(bin, "hi Bob").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(string(res), "error: ") {
+			t.Errorf("%v: Parse: %s", g.format, res)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package peg
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ErrNoSentence = errors.New("no sentence accepted by the grammar")
+
+// GenerateOptions controls sentences generated by Generate. Zero values are
+// replaced with defaults.
+type GenerateOptions struct {
+	Start     string               // rule to generate, the first rule if ""
+	MaxDepth  int                  // nesting of rules after which the shortest alternatives are chosen, 10 by default
+	MaxRepeat int                  // maximum repetitions of * and +, 3 by default
+	MaxTries  int                  // sentences generated until one is accepted, 100 by default
+	Weights   map[string][]float64 // weights of alternatives of rules, 1 if missing
+}
+
+// noHeight is the height of expressions deriving no sentence.
+const noHeight = int(^uint(0) >> 1)
+
+type generator struct {
+	rng    *rand.Rand
+	opts   GenerateOptions
+	rules  map[string]*Rule
+	height map[string]int // least nesting of rules in sentences of each rule
+	prog   *Program       // checks sentences, nil if not supported by the VM
+	depth  int
+	buf    []rune
+	indent []int // indentation stack
+	err    error // first error of the sentence
+}
+
+// Generate returns a random sentence of tree, which is accepted by its
+// parser. Sentences are derived by choosing alternatives and numbers of
+// repetitions with rng, then matched with the VM, so that sentences failing
+// predicates or taking other alternatives of ordered choices are rejected.
+// Sentences of grammars not supported by the VM backend are not checked.
+// Semantic predicates are assumed to hold, and token input is not supported.
+// Like Check, Generate fills Expr of trees built with the deprecated
+// PrimaryExpr field with Upgrade.
+func Generate(tree *Tree, rng *rand.Rand, opts *GenerateOptions) (string, error) {
+	g, err := newGenerator(tree, rng, opts)
+	if err != nil {
+		return "", err
+	}
+	return g.sentence()
+}
+
+// WriteFuzzCorpus writes n distinct sentences of tree generated by Generate
+// into dir, usually testdata/fuzz/FuzzXxx, as a seed corpus of go test -fuzz
+// for a fuzz target taking a string.
+func WriteFuzzCorpus(dir string, n int, tree *Tree, rng *rand.Rand, opts *GenerateOptions) error {
+	g, err := newGenerator(tree, rng, opts)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for tries := 0; len(seen) < n && tries < n*g.opts.MaxTries; tries++ {
+		s, err := g.sentence()
+		if err != nil {
+			return err
+		}
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+
+		data := []byte("go test fuzz v1\nstring(" + strconv.Quote(s) + ")\n")
+		name := fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newGenerator(tree *Tree, rng *rand.Rand, opts *GenerateOptions) (*generator, error) {
+	Upgrade(tree)
+	g := &generator{
+		rng:    rng,
+		rules:  map[string]*Rule{},
+		height: map[string]int{},
+	}
+	if opts != nil {
+		g.opts = *opts
+	}
+	if g.opts.Start == "" {
+		g.opts.Start = tree.RuleList[0].Name
+	}
+	if g.opts.MaxDepth == 0 {
+		g.opts.MaxDepth = 10
+	}
+	if g.opts.MaxRepeat == 0 {
+		g.opts.MaxRepeat = 3
+	}
+	if g.opts.MaxTries == 0 {
+		g.opts.MaxTries = 100
+	}
+
+	for _, r := range tree.RuleList {
+		g.rules[r.Name] = r
+		g.height[r.Name] = noHeight
+	}
+	if _, ok := g.rules[g.opts.Start]; !ok {
+		return nil, errors.New(fmt.Sprintf("Rule %q undefined", g.opts.Start))
+	}
+	var kind *KindMatcher
+	Inspect(tree, func(n Node) bool {
+		if k, ok := n.(*KindMatcher); ok && kind == nil {
+			kind = k
+		}
+		return kind == nil
+	})
+	if kind != nil {
+		return nil, errors.New(fmt.Sprintf("Token input (@%s) is not supported by Generate", kind.Kind))
+	}
+
+	// heights of rules, until no rule gets a shorter derivation
+	for changed := true; changed; {
+		changed = false
+		for _, r := range tree.RuleList {
+			if h := g.choiceHeight(r.ChoiceExpr); h != noHeight && h+1 < g.height[r.Name] {
+				g.height[r.Name] = h + 1
+				changed = true
+			}
+		}
+	}
+	if g.height[g.opts.Start] == noHeight {
+		return nil, errors.New(fmt.Sprintf("Rule %q derives no sentence", g.opts.Start))
+	}
+
+	g.prog = compileChecker(tree)
+
+	return g, nil
+}
+
+// compileChecker compiles tree to check sentences, or returns nil if tree has
+// expressions not supported by the VM backend.
+func compileChecker(tree *Tree) (prog *Program) {
+	defer func() {
+		if recover() != nil {
+			prog = nil
+		}
+	}()
+	prog, _ = tree.Compile()
+	return
+}
+
+func (g *generator) sentence() (string, error) {
+	for tries := 0; tries < g.opts.MaxTries; tries++ {
+		g.depth = 0
+		g.buf = g.buf[:0]
+		g.indent = []int{0}
+		g.err = nil
+		g.ruleRef(g.opts.Start)
+		if g.err != nil {
+			return "", g.err
+		}
+
+		if g.prog == nil {
+			return string(g.buf), nil
+		}
+		if _, n, err := g.prog.MatchRule(g.opts.Start, g.buf, nil); err == nil && n == len(g.buf) {
+			return string(g.buf), nil
+		}
+	}
+	return "", ErrNoSentence
+}
+
+func (g *generator) choiceHeight(ce *ChoiceExpr) int {
+	min := noHeight
+	for _, ae := range ce.ActionExprs {
+		if h := g.seqHeight(ae.SeqExpr); h < min {
+			min = h
+		}
+	}
+	return min
+}
+
+func (g *generator) seqHeight(se *SeqExpr) int {
+	max := 0
+	for _, le := range se.LabeledExprs {
+		if le.PrefixedExpr.PrefixOp != 0 {
+			continue
+		}
+		switch le.PrefixedExpr.SuffixedExpr.SuffixOp {
+		case QUESTION, STAR:
+			continue
+		}
+		max = maxInt(max, g.primaryHeight(le.PrefixedExpr.SuffixedExpr.PrimaryExpr))
+	}
+	return max
+}
+
+func (g *generator) primaryHeight(pe *PrimaryExpr) int {
+	switch e := pe.Expr.(type) {
+	case *ClassMatcher:
+		if matchesNothing(e.Class) {
+			return noHeight
+		}
+	case *RuleRef:
+		return g.height[e.Name]
+	case *SubExpr:
+		return g.choiceHeight(e.ChoiceExpr)
+	case *RecoverExpr:
+		// only reached on syntax errors
+		return noHeight
+	}
+	return 0
+}
+
+// choose returns the index of the alternative of ce to generate, weighted by
+// weights, or one of the shortest after MaxDepth.
+func (g *generator) choose(ce *ChoiceExpr, weights []float64) int {
+	heights := make([]int, len(ce.ActionExprs))
+	min := noHeight
+	for i, ae := range ce.ActionExprs {
+		heights[i] = g.seqHeight(ae.SeqExpr)
+		if heights[i] < min {
+			min = heights[i]
+		}
+	}
+
+	if g.depth < g.opts.MaxDepth {
+		total := 0.0
+		for i := range ce.ActionExprs {
+			if heights[i] != noHeight {
+				total += weight(weights, i)
+			}
+		}
+		if total > 0 {
+			x := g.rng.Float64() * total
+			for i := range ce.ActionExprs {
+				if heights[i] == noHeight {
+					continue
+				}
+				if x -= weight(weights, i); x < 0 {
+					return i
+				}
+			}
+		}
+	}
+
+	shortest := []int{}
+	for i, h := range heights {
+		if h == min {
+			shortest = append(shortest, i)
+		}
+	}
+	return shortest[g.rng.Intn(len(shortest))]
+}
+
+func weight(weights []float64, i int) float64 {
+	if i < len(weights) {
+		return weights[i]
+	}
+	return 1
+}
+
+func (g *generator) choiceExpr(ce *ChoiceExpr, weights []float64) {
+	g.seqExpr(ce.ActionExprs[g.choose(ce, weights)].SeqExpr)
+}
+
+func (g *generator) seqExpr(se *SeqExpr) {
+	for _, le := range se.LabeledExprs {
+		if le.PrefixedExpr.PrefixOp != 0 {
+			// predicates are checked by matching the sentence
+			continue
+		}
+		g.suffixedExpr(le.PrefixedExpr.SuffixedExpr)
+	}
+}
+
+func (g *generator) suffixedExpr(se *SuffixedExpr) {
+	n := 1
+	// ? and * do not add to the height, so their expression may derive no
+	// sentence
+	limited := g.depth >= g.opts.MaxDepth || g.primaryHeight(se.PrimaryExpr) == noHeight
+	switch se.SuffixOp {
+	case QUESTION:
+		n = g.rng.Intn(2)
+		if limited {
+			n = 0
+		}
+	case STAR:
+		n = g.rng.Intn(g.opts.MaxRepeat + 1)
+		if limited {
+			n = 0
+		}
+	case PLUS:
+		n = 1 + g.rng.Intn(g.opts.MaxRepeat)
+		if limited {
+			n = 1
+		}
+	}
+	for i := 0; i < n; i++ {
+		g.primaryExpr(se.PrimaryExpr)
+	}
+}
+
+func (g *generator) primaryExpr(pe *PrimaryExpr) {
+	switch e := pe.Expr.(type) {
+	case *AnyMatcher:
+		g.buf = append(g.buf, g.printable())
+	case *LitMatcher:
+		g.buf = append(g.buf, []rune(e.Lit)...)
+	case *ClassMatcher:
+		c, err := g.charRange(e.Class)
+		if err != nil {
+			if g.err == nil {
+				g.err = err
+			}
+			return
+		}
+		g.buf = append(g.buf, c)
+	case *KindMatcher:
+		panic("token input is not supported by Generate")
+	case *RuleRef:
+		g.ruleRef(e.Name)
+	case *SubExpr:
+		g.choiceExpr(e.ChoiceExpr, nil)
+	case *IndentExpr:
+		top := g.indent[len(g.indent)-1]
+		switch e.Type {
+		case INDENT:
+			top += 4
+			g.indent = append(g.indent, top)
+		case DEDENT:
+			if len(g.indent) > 1 {
+				g.indent = g.indent[:len(g.indent)-1]
+			}
+			return
+		}
+		g.buf = append(g.buf, '\n')
+		g.buf = append(g.buf, []rune(strings.Repeat(" ", top))...)
+	}
+	// %recover, ^, %{ } and semantic predicates match nothing
+}
+
+func (g *generator) ruleRef(name string) {
+	g.depth++
+	g.choiceExpr(g.rules[name].ChoiceExpr, g.opts.Weights[name])
+	g.depth--
+}
+
+// printable returns a random printable ASCII character.
+func (g *generator) printable() rune {
+	return rune(' ' + g.rng.Intn('~'-' '+1))
+}
+
+// charRange returns a random character matched by cr, or an error if cr
+// matches none.
+func (g *generator) charRange(cr *CharRange) (rune, error) {
+	if matchesNothing(cr) {
+		return 0, errors.New(fmt.Sprintf("Character class %v matches nothing", cr))
+	}
+
+	if !cr.Not {
+		c := cr.Chars[g.rng.Intn(len(cr.Chars))]
+		return c.Start + rune(g.rng.Intn(int(c.End-c.Start)+1)), nil
+	}
+
+	for i := 0; i < 100; i++ {
+		if c := g.printable(); cr.Match(c) {
+			return c, nil
+		}
+	}
+	for c := rune(' '); c <= unicode.MaxRune; c++ {
+		if cr.Match(c) {
+			return c, nil
+		}
+	}
+	for c := rune(0); c < ' '; c++ {
+		if cr.Match(c) {
+			return c, nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("Character class %v matches nothing", cr))
+}
+
+// matchesNothing reports whether cr is empty, or negated and its ranges cover
+// all characters.
+func matchesNothing(cr *CharRange) bool {
+	if !cr.Not {
+		return len(cr.Chars) == 0
+	}
+
+	chars := append([]*Char{}, cr.Chars...)
+	sort.Slice(chars, func(i, j int) bool { return chars[i].Start < chars[j].Start })
+	next := rune(0) // first character not covered yet
+	for _, c := range chars {
+		if c.Start > next {
+			return false
+		}
+		if c.End >= next {
+			next = c.End + 1
+		}
+	}
+	return next > unicode.MaxRune
+}
@@ -0,0 +1,56 @@
+package peg_test
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+func TestGenerateTokenInput(t *testing.T) {
+	peg.TokenInput = true
+	defer func() { peg.TokenInput = false }()
+	tree, err := peg.ReadTree(strings.NewReader(`
+Expr = @NUMBER ("+" @NUMBER)*
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = peg.Generate(tree, rand.New(rand.NewSource(1)), nil)
+	if err == nil || !strings.Contains(err.Error(), "@NUMBER") {
+		t.Errorf("got error %v, want token input not supported", err)
+	}
+}
+
+func TestGenerateNoSentence(t *testing.T) {
+	for _, c := range []struct {
+		grammar string
+		want    string // sentence, or error if it starts with "error: "
+	}{
+		{`A = "a" []?`, "a"},
+		{`A = "a" []* / []`, "a"},
+		{"A = \"a\" [^\x00-\U0010FFFF]?", "a"},
+		{"A = [^\U0010FFFF-\U0010FFFF\x00-\U0010FFFE]", `error: Rule "A" derives no sentence`},
+		{"A = \"a\" B* \"c\"\nB = \"b\" B", "ac"},
+		{"A = \"a\" B? \"c\"\nB = \"b\" B", "ac"},
+		{"A = B\nB = \"b\" B", `error: Rule "A" derives no sentence`},
+	} {
+		tree, err := peg.ReadTree(strings.NewReader(c.grammar))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := int64(0); i < 20; i++ {
+			s, err := peg.Generate(tree, rand.New(rand.NewSource(i)), nil)
+			if err != nil {
+				s = "error: " + err.Error()
+			}
+			if s != c.want {
+				t.Errorf("Generate(%q) = %s, want %s", c.grammar, s, c.want)
+				break
+			}
+		}
+	}
+}
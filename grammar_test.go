@@ -0,0 +1,162 @@
+package peg_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+	"github.com/laurence6/PEG.go/internal/gentest"
+	"github.com/laurence6/PEG.go/pegtest"
+)
+
+// pegtestMain parses each line of stdin, a rule and a quoted input, as the
+// input prefixed with the rule for the rule added by dispatch, and prints the
+// value printed by fmt.Sprint or the error, quoted.
+const pegtestMain = `package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gentest/parser"
+)
+
+func main() {
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		i := strings.IndexByte(in.Text(), ' ')
+		src, _ := strconv.Unquote(in.Text()[i+1:])
+		v, err := parser.Parse([]rune("\x00" + in.Text()[:i] + "\x00" + src))
+		if err != nil {
+			fmt.Println("error", strconv.Quote(err.Error()))
+		} else {
+			fmt.Println("ok", strconv.Quote(fmt.Sprint(v)))
+		}
+	}
+}
+`
+
+// dispatch returns tree with a first rule which, for each rule R, matches
+// "\x00R\x00" followed by input matched by R as a whole, and returns its
+// value.
+func dispatch(tree *peg.Tree) *peg.Tree {
+	item := func(e peg.Expr) *peg.LabeledExpr {
+		return &peg.LabeledExpr{PrefixedExpr: &peg.PrefixedExpr{
+			SuffixedExpr: &peg.SuffixedExpr{PrimaryExpr: peg.NewPrimaryExpr(e)},
+		}}
+	}
+
+	ce := &peg.ChoiceExpr{}
+	for _, r := range tree.RuleList {
+		v := item(&peg.RuleRef{Name: r.Name})
+		v.Label = "v"
+		end := item(&peg.AnyMatcher{})
+		end.PrefixedExpr.PrefixOp = peg.NOT
+		ce.ActionExprs = append(ce.ActionExprs, &peg.ActionExpr{
+			SeqExpr: &peg.SeqExpr{LabeledExprs: []*peg.LabeledExpr{
+				item(&peg.LitMatcher{Lit: "\x00" + r.Name + "\x00"}), v, end,
+			}},
+			Code: " return v ",
+		})
+	}
+
+	grammar := *tree.Grammar
+	grammar.RuleList = append([]*peg.Rule{{Name: "PEGTEST", ChoiceExpr: ce}}, tree.RuleList...)
+	return &peg.Tree{Grammar: &grammar}
+}
+
+// pegtestParser returns a ParseFunc running the parser of tree generated with
+// the backend selected by peg.VMBackend.
+func pegtestParser(t *testing.T, tree *peg.Tree) pegtest.ParseFunc {
+	cmd := exec.Command(gentest.Build(t, dispatch(tree), pegtestMain))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		cmd.Wait()
+	})
+
+	out := bufio.NewReader(stdout)
+	return func(rule, src string) (interface{}, error) {
+		fmt.Fprintln(stdin, rule, strconv.Quote(src))
+		line, err := out.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		i := strings.IndexByte(line, ' ')
+		s, err := strconv.Unquote(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, err
+		}
+		if line[:i] == "error" {
+			return nil, errors.New(s)
+		}
+		return s, nil
+	}
+}
+
+// testGrammar runs the tests of file on the parsers of grammar generated
+// with each backend, and without results on the VM if vm.
+func testGrammar(t *testing.T, grammar, file string, vm bool) {
+	backends := []bool{false}
+	if vm {
+		backends = append(backends, true)
+	}
+	for _, backend := range backends {
+		name := "Closure"
+		if backend {
+			name = "VM"
+		}
+		t.Run(name, func(t *testing.T) {
+			peg.VMBackend = backend
+			defer func() { peg.VMBackend = false }()
+			pegtest.RunFunc(t, file, pegtestParser(t, readGrammar(t, grammar)))
+		})
+	}
+
+	if !vm {
+		return
+	}
+	t.Run("Match", func(t *testing.T) {
+		parse, err := pegtest.VM(readGrammar(t, grammar))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cases, err := pegtest.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cases {
+			// values differ without actions
+			c.Result = ""
+			if err := c.Check(parse); err != nil {
+				t.Errorf("%s:%d: %v", file, c.Line, err)
+			}
+		}
+	})
+}
+
+func TestJSONGrammar(t *testing.T) {
+	testGrammar(t, "testdata/json.peg", "testdata/json.pegtest", true)
+}
+
+func TestOutlineGrammar(t *testing.T) {
+	testGrammar(t, "testdata/outline.peg", "testdata/outline.pegtest", false)
+}
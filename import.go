@@ -0,0 +1,851 @@
+package peg
+
+import (
+	"errors"
+	"fmt"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type importer struct {
+	format   Format
+	src      []rune
+	n        int // current position
+	tree     *Tree
+	warnings []error
+	renamed  map[string]string // names which are not identifiers of PEG.go
+}
+
+// importError is a syntax error, recovered by ImportTree.
+type importError struct {
+	error
+}
+
+// ImportTree reads a grammar in format, which is FormatPigeon, FormatPEGjs or
+// FormatABNF, and converts it to a Tree of package parser, or the package of
+// a pigeon initializer other than main. Features without equivalent are
+// dropped with a warning. Warnings and syntax errors start with line:col.
+func ImportTree(r io.Reader, format Format) (tree *Tree, warnings []error, err error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	im := &importer{
+		format:  format,
+		src:     []rune(string(src)),
+		tree:    &Tree{&Grammar{Package: "parser", Import: []*Import{}}},
+		renamed: map[string]string{},
+	}
+	// Packages used by generated parsers
+	for _, path := range []string{"bytes", "errors", "fmt", "reflect"} {
+		im.tree.Import = append(im.tree.Import, &Import{Path: path})
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			ie, ok := e.(importError)
+			if !ok {
+				panic(e)
+			}
+			tree, warnings, err = nil, im.warnings, ie.error
+		}
+	}()
+
+	switch format {
+	case FormatPigeon, FormatPEGjs:
+		im.pegGrammar()
+	case FormatABNF:
+		im.abnfGrammar()
+	default:
+		return nil, nil, errors.New(fmt.Sprintf("Import from %v not supported", format))
+	}
+	if len(im.tree.RuleList) == 0 {
+		im.errorf(im.n, "no rules")
+	}
+
+	return im.tree, im.warnings, nil
+}
+
+// pos returns the position of n.
+func (im *importer) pos(n int) Pos {
+	pos := Pos{Line: 1, Col: 1}
+	for _, c := range im.src[:n] {
+		if c == '\n' {
+			pos.Line++
+			pos.Col = 1
+		} else {
+			pos.Col++
+		}
+	}
+	return pos
+}
+
+func (im *importer) errorf(n int, format string, a ...interface{}) {
+	pos := im.pos(n)
+	panic(importError{errors.New(
+		fmt.Sprintf("%d:%d: ", pos.Line, pos.Col) + fmt.Sprintf(format, a...),
+	)})
+}
+
+func (im *importer) warnf(n int, format string, a ...interface{}) {
+	pos := im.pos(n)
+	im.warnings = append(im.warnings, errors.New(
+		fmt.Sprintf("%d:%d: ", pos.Line, pos.Col)+fmt.Sprintf(format, a...),
+	))
+}
+
+// peek returns the character at n+i, or -1 at EOF.
+func (im *importer) peek(i int) rune {
+	if im.n+i >= len(im.src) {
+		return -1
+	}
+	return im.src[im.n+i]
+}
+
+func (im *importer) lookingAt(s string) bool {
+	for i, c := range []rune(s) {
+		if im.peek(i) != c {
+			return false
+		}
+	}
+	return true
+}
+
+func (im *importer) accept(s string) bool {
+	if im.lookingAt(s) {
+		im.n += len([]rune(s))
+		return true
+	}
+	return false
+}
+
+func (im *importer) expect(s string) {
+	if !im.accept(s) {
+		im.errorf(im.n, "expect %q", s)
+	}
+}
+
+// ident returns an identifier of letters, digits, '_' and '$', or "".
+func (im *importer) ident() string {
+	start := im.n
+	for c := im.peek(0); unicode.IsLetter(c) || c == '_' || c == '$' || im.n > start && unicode.IsDigit(c); c = im.peek(0) {
+		im.n++
+	}
+	return string(im.src[start:im.n])
+}
+
+// number returns a decimal number, or -1.
+func (im *importer) number() int {
+	start := im.n
+	for isDigit(im.peek(0)) {
+		im.n++
+	}
+	if im.n == start {
+		return -1
+	}
+	n, _ := strconv.Atoi(string(im.src[start:im.n]))
+	return n
+}
+
+var identRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// name returns name as an identifier of PEG.go, not a keyword.
+func (im *importer) name(name string, n int) string {
+	if r, ok := im.renamed[name]; ok {
+		return r
+	}
+	r := name
+	if !identRegexp.MatchString(r) {
+		r = strings.Map(func(c rune) rune {
+			if isIdentContChar(c) {
+				return c
+			}
+			return '_'
+		}, r)
+		if isDigit(rune(r[0])) {
+			r = "_" + r
+		}
+	}
+	if isKeyword([]rune(r)) != NONE {
+		r += "_"
+	}
+	if r != name {
+		im.warnf(n, "%q renamed %q", name, r)
+	}
+	im.renamed[name] = r
+	return r
+}
+
+// Builders of Tree
+
+func sequence(les ...*LabeledExpr) *ActionExpr {
+	return &ActionExpr{SeqExpr: &SeqExpr{LabeledExprs: les}}
+}
+
+func item(pe Expr, suffix TokenType) *LabeledExpr {
+	return &LabeledExpr{PrefixedExpr: &PrefixedExpr{
+		SuffixedExpr: &SuffixedExpr{PrimaryExpr: NewPrimaryExpr(pe), SuffixOp: suffix},
+	}}
+}
+
+// group returns les as a primary expression.
+func group(les []*LabeledExpr) Expr {
+	if len(les) == 1 && les[0].Label == "" && les[0].PrefixedExpr.PrefixOp == 0 && les[0].PrefixedExpr.SuffixedExpr.SuffixOp == 0 {
+		return les[0].PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr
+	}
+	if len(les) == 0 {
+		return &LitMatcher{""}
+	}
+	return &SubExpr{&ChoiceExpr{ActionExprs: []*ActionExpr{sequence(les...)}}}
+}
+
+// repeat returns pe repeated from min to max times, or more if max < 0.
+func repeat(pe Expr, min, max int) *LabeledExpr {
+	switch {
+	case min == 1 && max == 1:
+		return item(pe, 0)
+	case min == 0 && max == 1:
+		return item(pe, QUESTION)
+	case min == 0 && max < 0:
+		return item(pe, STAR)
+	case min == 1 && max < 0:
+		return item(pe, PLUS)
+	}
+
+	les := []*LabeledExpr{}
+	for i := 0; i < min; i++ {
+		les = append(les, item(pe, 0))
+	}
+	if max < 0 {
+		les = append(les, item(pe, STAR))
+	}
+	for i := min; i < max; i++ {
+		les = append(les, item(pe, QUESTION))
+	}
+	return item(group(les), 0)
+}
+
+// caseless returns a matcher of s in any case.
+func caseless(s string) Expr {
+	les := []*LabeledExpr{}
+	run := []rune{}
+	for _, c := range s {
+		if unicode.SimpleFold(c) == c {
+			run = append(run, c)
+			continue
+		}
+		if len(run) > 0 {
+			les = append(les, item(&LitMatcher{string(run)}, 0))
+			run = []rune{}
+		}
+		cr := &CharRange{}
+		for f := c; ; {
+			cr.Chars = append(cr.Chars, newCharRangeSingle(f))
+			if f = unicode.SimpleFold(f); f == c {
+				break
+			}
+		}
+		les = append(les, item(&ClassMatcher{cr}, 0))
+	}
+	if len(run) > 0 || len(les) == 0 {
+		les = append(les, item(&LitMatcher{string(run)}, 0))
+	}
+	return group(les)
+}
+
+// caselessClass adds other cases of letters in cr.
+func caselessClass(cr *CharRange) {
+	for _, c := range cr.Chars {
+		for _, to := range []func(rune) rune{unicode.ToUpper, unicode.ToLower} {
+			start, end := to(c.Start), to(c.End)
+			if end-start == c.End-c.Start && (start != c.Start || end != c.End) {
+				cr.Chars = append(cr.Chars, newCharRange(start, end))
+			}
+		}
+	}
+}
+
+// Pigeon and PEG.js
+
+// space skips spaces and comments.
+func (im *importer) space() {
+	for {
+		switch c := im.peek(0); {
+		case unicode.IsSpace(c) || c == '\uFEFF':
+			im.n++
+		case im.lookingAt("//") && !(im.format == FormatPigeon && im.lookingAt("//{")):
+			for c := im.peek(0); c != -1 && c != '\n'; c = im.peek(0) {
+				im.n++
+			}
+		case im.lookingAt("/*"):
+			start := im.n
+			im.n += 2
+			for !im.accept("*/") {
+				if im.peek(0) == -1 {
+					im.errorf(start, "unterminated comment")
+				}
+				im.n++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (im *importer) pegGrammar() {
+	im.space()
+	for im.peek(0) == '{' {
+		start := im.n
+		if im.format == FormatPEGjs {
+			im.code()
+			im.warnf(start, "JavaScript initializer dropped")
+		} else {
+			im.pigeonInit(im.code(), start)
+		}
+		im.space()
+		im.accept(";")
+		im.space()
+	}
+
+	for im.peek(0) != -1 {
+		start := im.n
+		name := im.ident()
+		if name == "" {
+			im.errorf(im.n, "expect rule name")
+		}
+		im.space()
+		if c := im.peek(0); c == '"' || c == '\'' || c == '`' {
+			n := im.n
+			im.stringLit()
+			im.warnf(n, "display name of %q dropped", name)
+			im.space()
+		}
+		if !im.ruleDefOp() {
+			im.errorf(im.n, "expect \"=\"")
+		}
+		im.space()
+		ce := im.pegChoice()
+		im.space()
+		im.accept(";")
+		im.space()
+
+		im.tree.RuleList = append(im.tree.RuleList, &Rule{Name: im.name(name, start), ChoiceExpr: ce})
+	}
+}
+
+func (im *importer) ruleDefOp() bool {
+	if im.accept("=") {
+		return true
+	}
+	return im.format == FormatPigeon && (im.accept("<-") || im.accept("←") || im.accept("⟵"))
+}
+
+// atRule reports whether a rule starts at the current position.
+func (im *importer) atRule() bool {
+	defer func(n int) { im.n = n }(im.n)
+	if im.ident() == "" {
+		return false
+	}
+	im.space()
+	if c := im.peek(0); c == '"' || c == '\'' || c == '`' {
+		im.stringLit()
+		im.space()
+	}
+	return im.ruleDefOp()
+}
+
+func (im *importer) pegChoice() *ChoiceExpr {
+	ce := &ChoiceExpr{}
+	for {
+		ce.ActionExprs = append(ce.ActionExprs, im.pegAction())
+		im.space()
+		if im.format == FormatPigeon && im.lookingAt("//{") {
+			im.warnf(im.n, "recovery expression dropped")
+			im.n += 2
+			im.code()
+			im.space()
+			im.pegChoice()
+			return ce
+		}
+		if !im.accept("/") && !(im.format == FormatPigeon && im.accept("▸")) {
+			return ce
+		}
+		im.space()
+	}
+}
+
+func (im *importer) pegAction() *ActionExpr {
+	les, plucked := im.pegSeq()
+	ae := sequence(les...)
+
+	im.space()
+	if im.peek(0) == '{' {
+		start := im.n
+		code := im.code()
+		if im.format == FormatPigeon {
+			ae.Code = im.pigeonCode(code, "ret", "interface{}", start)
+		} else {
+			im.warnf(start, "JavaScript action dropped")
+		}
+	}
+
+	if len(plucked) > 0 && ae.Code == "" {
+		if len(plucked) == 1 {
+			ae.Code = "return " + plucked[0]
+		} else {
+			ae.Code = "return []interface{}{" + strings.Join(plucked, ", ") + "}"
+		}
+	}
+	return ae
+}
+
+// pegSeq returns labeled expressions and labels of plucked (@) ones.
+func (im *importer) pegSeq() ([]*LabeledExpr, []string) {
+	les := []*LabeledExpr{}
+	plucked := []string{}
+	for elements := 0; ; elements++ {
+		im.space()
+		switch c := im.peek(0); {
+		case c == -1 || c == '/' || c == ')' || c == '{' || c == ';' || c == '▸' || im.atRule():
+			if elements == 0 && c != '{' {
+				im.errorf(im.n, "expect expression")
+			}
+			if len(les) == 0 {
+				les = append(les, item(&LitMatcher{""}, 0))
+			}
+			return les, plucked
+		}
+
+		start := im.n
+		pluck := im.format == FormatPEGjs && im.accept("@")
+		label := ""
+		if id := im.ident(); id != "" {
+			im.space()
+			if im.peek(0) == ':' {
+				im.n++
+				im.space()
+				label = im.name(id, start)
+			} else {
+				im.n = start
+				if pluck {
+					im.n++
+				}
+			}
+		}
+		if pluck && label == "" {
+			label = fmt.Sprintf("__pluck%d", len(les))
+		}
+
+		if pe := im.pegPrefixed(); pe != nil {
+			if label != "" && gotoken.Lookup(label).IsKeyword() {
+				im.warnf(start, "label %q is a Go keyword", label)
+			}
+			les = append(les, &LabeledExpr{Label: label, PrefixedExpr: pe})
+			if pluck {
+				plucked = append(plucked, label)
+			}
+		}
+	}
+}
+
+func (im *importer) pegPrefixed() *PrefixedExpr {
+	start := im.n
+
+	if im.format == FormatPigeon && im.accept("%{") {
+		im.n--
+		im.code()
+		im.warnf(start, "throw expression dropped")
+		return nil
+	}
+
+	op := TokenType(0)
+	switch c := im.peek(0); {
+	case c == '&':
+		op = AND
+	case c == '!':
+		op = NOT
+	case c == '#' && im.format == FormatPigeon:
+		im.n++
+		im.space()
+		im.code()
+		im.warnf(start, "state code dropped")
+		return nil
+	case c == '$' && im.format == FormatPEGjs:
+		im.n++
+		im.space()
+		text := &LabeledExpr{Label: "v", PrefixedExpr: &PrefixedExpr{SuffixedExpr: im.pegSuffixed()}}
+		ae := sequence(text)
+		ae.Code = "return String(v)"
+		return item(&SubExpr{&ChoiceExpr{ActionExprs: []*ActionExpr{ae}}}, 0).PrefixedExpr
+	default:
+		return &PrefixedExpr{SuffixedExpr: im.pegSuffixed()}
+	}
+
+	im.n++
+	im.space()
+	if im.peek(0) == '{' {
+		code := im.code()
+		if im.format == FormatPEGjs {
+			im.warnf(start, "JavaScript predicate dropped")
+			return nil
+		}
+		return &PrefixedExpr{PrefixOp: op, SuffixedExpr: &SuffixedExpr{
+			PrimaryExpr: NewPrimaryExpr(&CodeExpr{im.pigeonCode(code, "ok", "bool", start)}),
+		}}
+	}
+	return &PrefixedExpr{PrefixOp: op, SuffixedExpr: im.pegSuffixed()}
+}
+
+func (im *importer) pegSuffixed() *SuffixedExpr {
+	pe := im.pegPrimary()
+	im.space()
+
+	switch im.peek(0) {
+	case '?':
+		im.n++
+		return &SuffixedExpr{PrimaryExpr: NewPrimaryExpr(pe), SuffixOp: QUESTION}
+	case '*':
+		im.n++
+		return &SuffixedExpr{PrimaryExpr: NewPrimaryExpr(pe), SuffixOp: STAR}
+	case '+':
+		im.n++
+		return &SuffixedExpr{PrimaryExpr: NewPrimaryExpr(pe), SuffixOp: PLUS}
+	case '|':
+		if im.format == FormatPEGjs {
+			min, max := im.pegRepetition()
+			return repeat(pe, min, max).PrefixedExpr.SuffixedExpr
+		}
+	}
+	return &SuffixedExpr{PrimaryExpr: NewPrimaryExpr(pe)}
+}
+
+// pegRepetition returns counts of |n|, |n..m|, |..m| or |n..| of Peggy.
+func (im *importer) pegRepetition() (int, int) {
+	start := im.n
+	im.expect("|")
+	im.space()
+	min := im.number()
+	max := min
+	im.space()
+	if im.accept("..") {
+		im.space()
+		max = im.number()
+		if min < 0 {
+			min = 0
+		}
+	}
+	if min < 0 {
+		im.errorf(im.n, "expect count")
+	}
+	im.space()
+	if im.accept(",") {
+		im.space()
+		im.pegPrimary()
+		im.space()
+		im.warnf(start, "delimiter of repetition dropped")
+	}
+	im.expect("|")
+	if max >= 0 && max < min {
+		im.errorf(start, "maximum less than minimum")
+	}
+	return min, max
+}
+
+func (im *importer) pegPrimary() Expr {
+	start := im.n
+	switch c := im.peek(0); {
+	case c == '"' || c == '\'' || c == '`' && im.format == FormatPigeon:
+		s := im.stringLit()
+		if im.accept("i") {
+			return caseless(s)
+		}
+		return &LitMatcher{s}
+	case c == '[':
+		cr := im.class()
+		if im.accept("i") {
+			caselessClass(cr)
+		}
+		return &ClassMatcher{cr}
+	case c == '.':
+		im.n++
+		return &AnyMatcher{}
+	case c == '(':
+		im.n++
+		im.space()
+		ce := im.pegChoice()
+		im.space()
+		im.expect(")")
+		return &SubExpr{ce}
+	}
+
+	if name := im.ident(); name != "" {
+		return &RuleRef{im.name(name, start)}
+	}
+	im.errorf(start, "expect expression")
+	return nil
+}
+
+// stringLit returns a string literal quoted with ", ' or `.
+func (im *importer) stringLit() string {
+	start := im.n
+	q := im.peek(0)
+	im.n++
+	s := []rune{}
+	for {
+		switch c := im.peek(0); {
+		case c == -1 || c == '\n' && q != '`':
+			im.errorf(start, "unterminated string")
+		case c == q:
+			im.n++
+			return string(s)
+		case c == '\\' && q != '`':
+			im.n++
+			if e := im.escape(); e >= 0 {
+				s = append(s, e)
+			}
+		default:
+			im.n++
+			s = append(s, c)
+		}
+	}
+}
+
+// class returns a character class without the i flag.
+func (im *importer) class() *CharRange {
+	start := im.n
+	im.expect("[")
+	cr := &CharRange{Chars: []*Char{}}
+	if im.accept("^") {
+		cr.Not = true
+	}
+
+	char := func() rune {
+		switch c := im.peek(0); c {
+		case -1, '\n':
+			im.errorf(start, "unterminated character class")
+		case '\\':
+			im.n++
+			return im.escape()
+		default:
+			im.n++
+			return c
+		}
+		return -1
+	}
+
+	for !im.accept("]") {
+		if im.format == FormatPigeon && (im.lookingAt("\\p") || im.lookingAt("\\P")) {
+			n := im.n
+			im.n += 2
+			if im.accept("{") {
+				for !im.accept("}") {
+					char()
+				}
+			} else {
+				im.n++
+			}
+			im.warnf(n, "Unicode class %s dropped", string(im.src[n:im.n]))
+			continue
+		}
+
+		c := char()
+		if c < 0 {
+			continue
+		}
+		if im.peek(0) == '-' && im.peek(1) != ']' {
+			im.n++
+			cr.Chars = append(cr.Chars, newCharRange(c, char()))
+		} else {
+			cr.Chars = append(cr.Chars, newCharRangeSingle(c))
+		}
+	}
+	return cr
+}
+
+// escape returns the character of an escape sequence of Go or JavaScript
+// after '\', or -1 for a line continuation.
+func (im *importer) escape() rune {
+	start := im.n - 1
+	hex := func(n int) rune {
+		v := rune(0)
+		for i := 0; i < n; i++ {
+			d, err := strconv.ParseUint(string(im.peek(0)), 16, 8)
+			if err != nil {
+				im.errorf(start, "invalid escape")
+			}
+			v = v*16 + rune(d)
+			im.n++
+		}
+		return v
+	}
+
+	c := im.peek(0)
+	im.n++
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'a':
+		return '\a'
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	case 'v':
+		return '\v'
+	case 'x':
+		return hex(2)
+	case 'u':
+		if im.accept("{") {
+			v := rune(0)
+			for !im.accept("}") {
+				v = v*16 + hex(1)
+			}
+			return v
+		}
+		return hex(4)
+	case 'U':
+		return hex(8)
+	case '\n':
+		return -1
+	case '\r':
+		im.accept("\n")
+		return -1
+	case -1:
+		im.errorf(start, "invalid escape")
+	}
+	if '0' <= c && c <= '7' {
+		v := c - '0'
+		for i := 0; i < 2 && '0' <= im.peek(0) && im.peek(0) <= '7'; i++ {
+			v = v*8 + im.peek(0) - '0'
+			im.n++
+		}
+		return v
+	}
+	return c
+}
+
+// code returns code between '{' and the matching '}', skipping strings and
+// comments of Go and JavaScript.
+func (im *importer) code() string {
+	start := im.n
+	im.expect("{")
+	depth := 0
+	for {
+		switch c := im.peek(0); {
+		case c == -1:
+			im.errorf(start, "unterminated code")
+		case c == '{':
+			depth++
+			im.n++
+		case c == '}':
+			if depth == 0 {
+				im.n++
+				return string(im.src[start+1 : im.n-1])
+			}
+			depth--
+			im.n++
+		case c == '"' || c == '\'' || c == '`':
+			im.n++
+			for d := im.peek(0); d != c; d = im.peek(0) {
+				if d == -1 {
+					im.errorf(start, "unterminated code")
+				}
+				if d == '\\' && c != '`' {
+					im.n++
+				}
+				im.n++
+			}
+			im.n++
+		case im.lookingAt("//"):
+			for d := im.peek(0); d != -1 && d != '\n'; d = im.peek(0) {
+				im.n++
+			}
+		case im.lookingAt("/*"):
+			im.n += 2
+			for !im.accept("*/") {
+				if im.peek(0) == -1 {
+					im.errorf(start, "unterminated code")
+				}
+				im.n++
+			}
+		default:
+			im.n++
+		}
+	}
+}
+
+var pigeonCurrent = regexp.MustCompile(`\bc\.(text|pos|state|globalStore)\b`)
+
+// pigeonCode wraps code of pigeon returning (typ, error) into code setting
+// result.
+func (im *importer) pigeonCode(code, result, typ string, n int) string {
+	if pigeonCurrent.MatchString(code) {
+		im.warnf(n, "c (*current) of pigeon used in code")
+	}
+	return fmt.Sprintf(
+		"\n\t%s, err := func() (%s, error) {%s}()\n"+
+			"\tif err != nil {\n"+
+			"\t\tpanic(err)\n"+
+			"\t}\n",
+		result, typ, code,
+	)
+}
+
+// pigeonInit takes the package clause and imports of the initializer of
+// pigeon at n, and the rest as code.
+func (im *importer) pigeonInit(code string, n int) {
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", code, goparser.ImportsOnly)
+	if err != nil {
+		im.tree.Code = code
+		return
+	}
+
+	if f.Name.Name == "main" {
+		// parsers of package main are generated with the main function of
+		// PEG.go
+		im.warnf(n, "package main imported as package %s", im.tree.Package)
+	} else {
+		im.tree.Package = f.Name.Name
+	}
+	end := fset.Position(f.Name.End()).Offset
+	for _, i := range f.Imports {
+		path, _ := strconv.Unquote(i.Path.Value)
+		imp := &Import{Path: path}
+		if i.Name != nil {
+			imp.Name = i.Name.Name
+		}
+		if !hasImport(im.tree.Import, imp) {
+			im.tree.Import = append(im.tree.Import, imp)
+		}
+	}
+	for _, d := range f.Decls {
+		if e := fset.Position(d.End()).Offset; e > end {
+			end = e
+		}
+	}
+
+	if rest := strings.TrimLeft(code[end:], "\r\n"); strings.TrimSpace(rest) != "" {
+		im.tree.Code = "\n" + rest
+	}
+}
+
+func hasImport(imports []*Import, imp *Import) bool {
+	for _, i := range imports {
+		if *i == *imp {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+// Package gentest builds parsers generated by PEG.go in temporary modules, for
+// tests and benchmarks of the generated code.
+package gentest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+// Build generates the parser of tree, with GenCode or, if peg.VMBackend,
+// GenVMCode, as package parser of a temporary module, and builds the command
+// of main, the source of its package main, which imports the parser as
+// "gentest/parser". It returns the path of the command, and skips tb if the
+// go command is not found.
+func Build(tb testing.TB, tree *peg.Tree, main string) string {
+	tb.Helper()
+
+	grammar := *tree.Grammar
+	grammar.Package = "parser"
+	parser := &bytes.Buffer{}
+	if peg.VMBackend {
+		(&peg.Tree{Grammar: &grammar}).GenVMCode(parser)
+	} else {
+		(&peg.Tree{Grammar: &grammar}).GenCode(parser)
+	}
+
+	return BuildSource(tb, parser.String(), main)
+}
+
+// BuildSource is like Build but takes the source of package parser, such as
+// a parser generated by an earlier version of PEG.go.
+func BuildSource(tb testing.TB, parser, main string) string {
+	tb.Helper()
+
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		tb.Skip("go command not found")
+	}
+
+	mod, err := findModule()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "gentest")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { os.RemoveAll(dir) })
+
+	gomod := fmt.Sprintf("module gentest\n\nrequire %s v0.0.0\n\nreplace %s => %s\n", mod.path, mod.path, mod.dir)
+	if mod.goVersion != "" {
+		gomod += "\ngo " + mod.goVersion + "\n"
+	}
+
+	files := map[string]string{
+		"go.mod":           gomod,
+		"main.go":          main,
+		"parser/parser.go": parser,
+	}
+	for name, src := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	bin := filepath.Join(dir, "main")
+	cmd := exec.Command(goCmd, "build", "-o", bin, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		tb.Fatalf("go build: %v\n%s", err, out)
+	}
+
+	return bin
+}
+
+type module struct {
+	path      string
+	dir       string
+	goVersion string
+}
+
+// findModule returns the module of PEG.go, whose go.mod is in the working
+// directory of the test or one of its parents.
+func findModule() (*module, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		f, err := os.Open(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			defer f.Close()
+			mod := &module{dir: dir}
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				fields := strings.Fields(scanner.Text())
+				if len(fields) == 2 && fields[0] == "module" {
+					mod.path = fields[1]
+				}
+				if len(fields) == 2 && fields[0] == "go" {
+					mod.goVersion = fields[1]
+				}
+			}
+			return mod, scanner.Err()
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.New("go.mod not found")
+		}
+		dir = parent
+	}
+}
@@ -3,6 +3,7 @@ package peg
 import (
 	"fmt"
 	"runtime"
+	"unicode"
 )
 
 type parser struct {
@@ -34,6 +35,8 @@ type Grammar struct {
 	Package  string
 	Import   []*Import
 	Code     string
+	State    string      // fields of parser state
+	Skip     *ChoiceExpr // skipped before tokens in syntactic rules
 	RuleList []*Rule
 }
 
@@ -63,6 +66,18 @@ func (p *parser) grammar() (*Grammar, ret) {
 		grammar.Code = string(code)
 	}
 
+	state, r := p.state()
+	if r.OK() {
+		n += r.n
+		grammar.State = string(state)
+	}
+
+	skip, r := p.skip()
+	if r.OK() {
+		n += r.n
+		grammar.Skip = skip
+	}
+
 	ruleList, r := p.ruleList()
 	if r.OK() {
 		n += r.n
@@ -78,6 +93,7 @@ func (p *parser) grammar() (*Grammar, ret) {
 		return nil, newRet(err)
 	}
 
+	resolveIndents(grammar)
 	return grammar, newRet(n)
 }
 
@@ -97,6 +113,46 @@ func (p *parser) packageName() (string, ret) {
 	return "", newRet(0)
 }
 
+func (p *parser) state() ([]rune, ret) {
+	if err := p.expect(STATE); err == nil {
+		p.advance()
+		n := 1
+		if code, r := p.code(); r.OK() {
+			n += r.n
+			return code, newRet(n)
+		} else {
+			p.back(n)
+			return nil, r
+		}
+	} else {
+		return nil, newRet(err)
+	}
+}
+
+func (p *parser) skip() (*ChoiceExpr, ret) {
+	if err := p.expect(SKIP); err != nil {
+		return nil, newRet(err)
+	}
+	p.advance()
+	n := 1
+
+	if err := p.expect(ASSIGN); err == nil {
+		p.advance()
+		n += 1
+	} else {
+		p.back(n)
+		return nil, newRet(err)
+	}
+
+	if exp, r := p.choiceExpr(); r.OK() {
+		n += r.n
+		return exp, newRet(n)
+	} else {
+		p.back(n)
+		return nil, r
+	}
+}
+
 type Import struct {
 	Name string
 	Path string
@@ -178,10 +234,25 @@ func (p *parser) ruleList() ([]*Rule, ret) {
 type Rule struct {
 	Name       string
 	ChoiceExpr *ChoiceExpr
+
+	Pos Pos // position in the grammar, zero if not read by GetTree
+	End Pos
+}
+
+// IsLexical reports whether rule name is a lexical rule, whose name has no
+// lowercase letters, like NUMBER or _. %skip is not applied inside them. A
+// one-letter name like A is lexical too.
+func IsLexical(name string) bool {
+	for _, c := range name {
+		if unicode.IsLower(c) {
+			return false
+		}
+	}
+	return true
 }
 
 func (p *parser) rule() (*Rule, ret) {
-	rule := &Rule{}
+	rule := &Rule{Pos: p.token.Pos}
 	n := 0
 
 	if id, r := p.ident(); r.OK() {
@@ -207,6 +278,7 @@ func (p *parser) rule() (*Rule, ret) {
 		return nil, r
 	}
 
+	rule.End = p.end()
 	return rule, newRet(n)
 }
 
@@ -254,10 +326,13 @@ func (p *parser) choiceExpr() (*ChoiceExpr, ret) {
 type ActionExpr struct {
 	SeqExpr *SeqExpr
 	Code    string
+
+	Pos Pos // position in the grammar, zero if not read by GetTree
+	End Pos
 }
 
 func (p *parser) actionExpr() (*ActionExpr, ret) {
-	exp := &ActionExpr{}
+	exp := &ActionExpr{Pos: p.token.Pos}
 	n := 0
 
 	e, r := p.seqExpr()
@@ -273,6 +348,7 @@ func (p *parser) actionExpr() (*ActionExpr, ret) {
 		exp.Code = string(code)
 	}
 
+	exp.End = p.end()
 	return exp, newRet(n)
 }
 
@@ -366,8 +442,17 @@ func (p *parser) prefixedExpr() (*PrefixedExpr, ret) {
 
 	op, r := p.prefixOp()
 	if r.OK() {
-		n += p.n
+		n += r.n
 		exp.PrefixOp = op
+
+		// semantic predicate
+		if code, r := p.code(); r.OK() {
+			n += r.n
+			exp.SuffixedExpr = &SuffixedExpr{
+				PrimaryExpr: NewPrimaryExpr(&CodeExpr{string(code)}),
+			}
+			return exp, newRet(n)
+		}
 	}
 
 	e, r := p.suffixedExpr()
@@ -397,10 +482,13 @@ func (p *parser) prefixOp() (TokenType, ret) {
 type SuffixedExpr struct {
 	PrimaryExpr *PrimaryExpr
 	SuffixOp    TokenType
+
+	Pos Pos // position in the grammar, zero if not read by GetTree
+	End Pos
 }
 
 func (p *parser) suffixedExpr() (*SuffixedExpr, ret) {
-	exp := &SuffixedExpr{}
+	exp := &SuffixedExpr{Pos: p.token.Pos}
 	n := 0
 
 	e, r := p.primaryExpr()
@@ -417,6 +505,7 @@ func (p *parser) suffixedExpr() (*SuffixedExpr, ret) {
 		exp.SuffixOp = op
 	}
 
+	exp.End = p.end()
 	return exp, newRet(n)
 }
 
@@ -436,36 +525,68 @@ func (p *parser) suffixOp() (TokenType, ret) {
 }
 
 type PrimaryExpr struct {
-	PrimaryExpr interface{} // *Matcher / string (rule) / *ChoiceExpr
+	Expr Expr
+
+	// Deprecated: PrimaryExpr holds Expr in its representation before Expr
+	// was added: *Matcher for matchers, string for *RuleRef, *ChoiceExpr for
+	// *SubExpr, and other expressions as they are. It is set by GetTree and
+	// NewPrimaryExpr, and will be removed in the next release. Expr is set
+	// from it by Upgrade if it is assigned.
+	PrimaryExpr interface{}
+
+	// Expr and PrimaryExpr when they last agreed, for Upgrade
+	syncedExpr Expr
+	synced     interface{}
+}
+
+// NewPrimaryExpr returns a PrimaryExpr of e, with the deprecated field set.
+func NewPrimaryExpr(e Expr) *PrimaryExpr {
+	pe := &PrimaryExpr{Expr: e}
+	pe.sync()
+	return pe
 }
 
 func (p *parser) primaryExpr() (*PrimaryExpr, ret) {
-	exp := &PrimaryExpr{}
+	var exp Expr
 	n := 0
 
 	if err := p.expect(STRING); err == nil {
-		exp.PrimaryExpr = getMatcherString(string(p.token.Literal))
+		exp = &LitMatcher{string(p.token.Literal)}
 		p.advance()
 		n += 1
 	} else if err = p.expect(RANGE); err == nil {
-		exp.PrimaryExpr = getMatcherRange(p.token.Literal)
+		exp = &ClassMatcher{getCharRange(p.token.Literal)}
 		p.advance()
 		n += 1
 	} else if err = p.expect(DOT); err == nil {
-		exp.PrimaryExpr = getMatcherDot()
+		exp = &AnyMatcher{}
+		p.advance()
+		n += 1
+	} else if err = p.expect(KIND); err == nil {
+		exp = &KindMatcher{string(p.token.Literal)}
 		p.advance()
 		n += 1
 	} else if id, r := p.ruleRef(); r.OK() {
 		n += r.n
-		exp.PrimaryExpr = id
+		exp = &RuleRef{id}
 	} else if e, r := p.subChoiceExpr(); r.OK() {
 		n += r.n
-		exp.PrimaryExpr = e
+		exp = &SubExpr{e}
+	} else if e, r := p.recoverExpr(); r.OK() {
+		n += r.n
+		exp = e
+	} else if e, r := p.throwExpr(); r.OK() {
+		n += r.n
+		exp = e
+	} else if err = p.expect(STATECODE); err == nil {
+		exp = &StateCodeExpr{string(p.token.Literal)}
+		p.advance()
+		n += 1
 	} else {
 		return nil, newRet(newTokenTypeError(1, STRING, p.token))
 	}
 
-	return exp, newRet(n)
+	return NewPrimaryExpr(exp), newRet(n)
 }
 
 func (p *parser) ruleRef() (string, ret) {
@@ -516,6 +637,118 @@ func (p *parser) subChoiceExpr() (*ChoiceExpr, ret) {
 	return exp, newRet(n)
 }
 
+// CodeExpr is Go code of a semantic predicate, which follows & or !.
+type CodeExpr struct {
+	Code string
+}
+
+// StateCodeExpr is Go code changing parser state, which matches nothing.
+type StateCodeExpr struct {
+	Code string
+}
+
+// IndentExpr matches indentation at the start of a line against the
+// indentation stack.
+type IndentExpr struct {
+	Type TokenType // INDENT / DEDENT / SAMEDENT
+}
+
+// indentKeywords are the names of IndentExprs, which are references to rules
+// in grammars defining rules of the names.
+var indentKeywords = map[string]TokenType{
+	"INDENT":   INDENT,
+	"DEDENT":   DEDENT,
+	"SAMEDENT": SAMEDENT,
+}
+
+// resolveIndents replaces references to INDENT, DEDENT and SAMEDENT with
+// IndentExprs, unless grammar defines rules of the names.
+func resolveIndents(grammar *Grammar) {
+	rules := map[string]bool{}
+	for _, r := range grammar.RuleList {
+		rules[r.Name] = true
+	}
+	Rewrite(grammar, func(n Node) Node {
+		if ref, ok := n.(*RuleRef); ok && !rules[ref.Name] {
+			if tt, ok := indentKeywords[ref.Name]; ok {
+				return &IndentExpr{tt}
+			}
+		}
+		return n
+	})
+}
+
+// RecoverExpr records a syntax error and skips input with Rule.
+type RecoverExpr struct {
+	Rule string
+}
+
+func (p *parser) recoverExpr() (*RecoverExpr, ret) {
+	exp := &RecoverExpr{}
+	n := 0
+
+	if err := p.expect(RECOVER); err == nil {
+		p.advance()
+		n += 1
+	} else {
+		return nil, newRet(err)
+	}
+
+	if err := p.expect(LPAREN); err == nil {
+		p.advance()
+		n += 1
+	} else {
+		p.back(n)
+		return nil, newRet(err)
+	}
+
+	if id, r := p.ident(); r.OK() {
+		n += r.n
+		exp.Rule = id
+	} else {
+		p.back(n)
+		return nil, r
+	}
+
+	if err := p.expect(RPAREN); err == nil {
+		p.advance()
+		n += 1
+	} else {
+		p.back(n)
+		return nil, newRet(err)
+	}
+
+	return exp, newRet(n)
+}
+
+// ThrowExpr matches nothing. If the rest of the sequence fails, a syntax error
+// with Msg is raised instead of backtracking.
+type ThrowExpr struct {
+	Msg string
+}
+
+func (p *parser) throwExpr() (*ThrowExpr, ret) {
+	exp := &ThrowExpr{}
+	n := 0
+
+	if err := p.expect(CARET); err == nil {
+		p.advance()
+		n += 1
+	} else {
+		return nil, newRet(err)
+	}
+
+	if s, r := p.string(); r.OK() {
+		n += r.n
+		exp.Msg = s
+	} else {
+		p.back(n)
+		return nil, r
+	}
+
+	return exp, newRet(n)
+}
+
 func (p *parser) ident() (string, ret) {
 	err := p.expect(IDENT)
 	if err == nil {
@@ -565,6 +798,11 @@ func (p *parser) back(n int) {
 	return
 }
 
+// end returns the position after the last token consumed.
+func (p *parser) end() Pos {
+	return p.tokens[p.n-1].End
+}
+
 func (p *parser) expect(tt TokenType) error {
 	if p.token.Type == tt {
 		return nil
@@ -573,20 +811,53 @@ func (p *parser) expect(tt TokenType) error {
 	}
 }
 
-type Matcher struct {
-	Matcher interface{} // int(dot) / string / *CharRange
+// Expr is the expression of a PrimaryExpr: *RuleRef, *LitMatcher,
+// *ClassMatcher, *AnyMatcher, *KindMatcher, *SubExpr, *RecoverExpr,
+// *ThrowExpr, *CodeExpr, *StateCodeExpr or *IndentExpr.
+type Expr interface {
+	Node
+	expr()
 }
 
-func getMatcherString(s string) *Matcher {
-	return &Matcher{Matcher: s}
+func (*RuleRef) expr()       {}
+func (*LitMatcher) expr()    {}
+func (*ClassMatcher) expr()  {}
+func (*AnyMatcher) expr()    {}
+func (*KindMatcher) expr()   {}
+func (*SubExpr) expr()       {}
+func (*RecoverExpr) expr()   {}
+func (*ThrowExpr) expr()     {}
+func (*CodeExpr) expr()      {}
+func (*StateCodeExpr) expr() {}
+func (*IndentExpr) expr()    {}
+
+// RuleRef references the rule Name.
+type RuleRef struct {
+	Name string
 }
 
-func getMatcherRange(r []rune) *Matcher {
-	return &Matcher{Matcher: getCharRange(r)}
+// LitMatcher matches the string Lit, or a token of text Lit in token input
+// mode.
+type LitMatcher struct {
+	Lit string
 }
 
-func getMatcherDot() *Matcher {
-	return &Matcher{Matcher: 0xd07}
+// ClassMatcher matches a character of Class.
+type ClassMatcher struct {
+	Class *CharRange
+}
+
+// AnyMatcher matches any character, or any token in token input mode.
+type AnyMatcher struct{}
+
+// KindMatcher matches a token of Kind in token input mode.
+type KindMatcher struct {
+	Kind string
+}
+
+// SubExpr is a parenthesized choice.
+type SubExpr struct {
+	ChoiceExpr *ChoiceExpr
 }
 
 type CharRange struct {
@@ -625,6 +896,45 @@ func getCharRange(r []rune) *CharRange {
 	return &CharRange{Not: not, Chars: chars}
 }
 
+// String returns cr in the syntax of character classes. A single '-' is
+// moved to the end, where it is not a range.
+func (cr *CharRange) String() string {
+	buf := []rune{'['}
+	if cr.Not {
+		buf = append(buf, '^')
+	}
+	dash := false
+	for _, c := range cr.Chars {
+		if c.Start == '-' && c.End == '-' {
+			dash = true
+			continue
+		}
+		buf = appendClassChar(buf, c.Start)
+		if c.End != c.Start {
+			buf = append(buf, '-')
+			buf = appendClassChar(buf, c.End)
+		}
+	}
+	if dash {
+		buf = append(buf, '-')
+	}
+	return string(append(buf, ']'))
+}
+
+func appendClassChar(buf []rune, c rune) []rune {
+	switch c {
+	case '\n':
+		return append(buf, '\\', 'n')
+	case '\r':
+		return append(buf, '\\', 'r')
+	case '\t':
+		return append(buf, '\\', 't')
+	case ']', '\\':
+		return append(buf, '\\', c)
+	}
+	return append(buf, c)
+}
+
 type Char struct {
 	Start rune
 	End   rune
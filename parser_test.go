@@ -0,0 +1,34 @@
+package peg_test
+
+import (
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+func TestIndentRuleNames(t *testing.T) {
+	tree, err := peg.ReadTree(strings.NewReader(`
+Block = INDENT Line (SAMEDENT Line)* DEDENT
+Line = "x"
+INDENT = "{"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	peg.Inspect(tree.RuleList[0], func(n peg.Node) bool {
+		switch n := n.(type) {
+		case *peg.RuleRef:
+			got = append(got, n.Name)
+		case *peg.IndentExpr:
+			got = append(got, n.Type.String()+" keyword")
+		}
+		return true
+	})
+	want := "INDENT Line SAMEDENT keyword Line DEDENT keyword"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, " "), want)
+	}
+}
@@ -0,0 +1,224 @@
+// Package pegtest runs tests of grammars written in .pegtest files, with the
+// VM of PEG.go or with a generated parser.
+//
+// Each line of a .pegtest file is a test, a comment starting with #, or
+// blank. A test is a rule, an input quoted like a Go string, optionally the
+// expected result, and optionally a comment starting with # after a space:
+//
+//	# rule input [result] [# comment]
+//	Expr "1+2" 3
+//	Number "12" # digits only
+//	Number !"1a"
+//
+// The test passes if the rule matches the whole input and the value printed
+// by fmt.Sprint is the result, or, if the input follows !, if the rule fails.
+// Results cannot contain " #".
+package pegtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+// Case is a test of a .pegtest file.
+type Case struct {
+	Line   int
+	Rule   string
+	Input  string
+	Reject bool   // the rule should fail
+	Result string // expected value printed by fmt.Sprint, not checked if ""
+}
+
+// ParseFunc parses src from rule, and fails unless the whole src is matched.
+type ParseFunc func(rule, src string) (interface{}, error)
+
+// Read reads tests from r.
+func Read(r io.Reader) ([]*Case, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cases := []*Case{}
+	for n, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		c, err := readCase(line)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%d: %v", n+1, err))
+		}
+		c.Line = n + 1
+		cases = append(cases, c)
+	}
+
+	return cases, nil
+}
+
+func readCase(line string) (*Case, error) {
+	c := &Case{}
+
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return nil, errors.New("missing input")
+	}
+	c.Rule, line = line[:i], strings.TrimSpace(line[i:])
+
+	if strings.HasPrefix(line, "!") {
+		c.Reject = true
+		line = line[1:]
+	}
+
+	quoted, err := strconv.QuotedPrefix(line)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("input should be a quoted string: %s", line))
+	}
+	c.Input, _ = strconv.Unquote(quoted)
+	c.Result = stripComment(line[len(quoted):])
+
+	if c.Reject && c.Result != "" {
+		return nil, errors.New("result of a rejected input")
+	}
+
+	return c, nil
+}
+
+// stripComment returns s without a comment starting with # after a space,
+// and without surrounding spaces.
+func stripComment(s string) string {
+	s = " " + s
+	for _, sep := range []string{" #", "\t#"} {
+		if i := strings.Index(s, sep); i >= 0 {
+			s = s[:i]
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// ReadFile reads tests from file name.
+func ReadFile(name string) ([]*Case, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cases, err := Read(f)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s:%v", name, err))
+	}
+	return cases, nil
+}
+
+// Check runs c with parse, and returns an error if it fails.
+func (c *Case) Check(parse ParseFunc) error {
+	v, err := parse(c.Rule, c.Input)
+	switch {
+	case c.Reject && err == nil:
+		return errors.New(fmt.Sprintf("%s accepted %q, want rejected", c.Rule, c.Input))
+	case c.Reject:
+		return nil
+	case err != nil:
+		return errors.New(fmt.Sprintf("%s rejected %q: %v", c.Rule, c.Input, err))
+	}
+
+	if got := fmt.Sprint(v); c.Result != "" && got != c.Result {
+		return errors.New(fmt.Sprintf("%s of %q = %s, want %s", c.Rule, c.Input, got, c.Result))
+	}
+	return nil
+}
+
+// VM returns a ParseFunc matching rules of tree with the VM. Actions are not
+// run, so values are not those of a generated parser, and semantic
+// predicates hold.
+func VM(tree *peg.Tree) (parse ParseFunc, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			parse, err = nil, errors.New(fmt.Sprint(e))
+		}
+	}()
+
+	prog, _ := tree.Compile()
+
+	return func(rule, src string) (interface{}, error) {
+		in := []rune(src)
+		v, n, err := prog.MatchRule(rule, in, nil)
+		if err != nil {
+			return nil, err
+		}
+		if n < len(in) {
+			return nil, errors.New(fmt.Sprintf("matched %d of %d characters", n, len(in)))
+		}
+		return v, nil
+	}, nil
+}
+
+// Run runs tests of file on the grammar file grammar with the VM, which does
+// not run actions. It fails if a test has a result, which should be tested
+// with a generated parser and RunFunc.
+func Run(t *testing.T, grammar, file string) {
+	f, err := os.Open(grammar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tree, err := peg.ReadTree(f)
+	if err != nil {
+		t.Fatalf("%s: %v", grammar, err)
+	}
+
+	parse, err := VM(tree)
+	if err != nil {
+		t.Fatalf("%s: %v", grammar, err)
+	}
+
+	cases, err := ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		if c.Result != "" {
+			t.Fatalf("%s:%d: result without actions, test it with a generated parser and RunFunc", file, c.Line)
+		}
+	}
+
+	runCases(t, file, cases, parse)
+}
+
+// RunFunc runs tests of file with parse, each as a subtest named after its
+// line and rule. A generated parser, which parses its first rule, can be
+// tested with
+//
+//	pegtest.RunFunc(t, "expr.pegtest", func(rule, src string) (interface{}, error) {
+//		return Parse([]rune(src))
+//	})
+func RunFunc(t *testing.T, file string, parse ParseFunc) {
+	cases, err := ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runCases(t, file, cases, parse)
+}
+
+func runCases(t *testing.T, file string, cases []*Case, parse ParseFunc) {
+	for _, c := range cases {
+		c := c
+		t.Run(fmt.Sprintf("%d_%s", c.Line, c.Rule), func(t *testing.T) {
+			if err := c.Check(parse); err != nil {
+				t.Errorf("%s:%d: %v", file, c.Line, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package pegtest
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	cases, err := Read(strings.NewReader(`# rule input [result] [# comment]
+Expr "1+2" 3 # sum
+Expr "[1]" [1]	# list
+Number "12" # digits only
+Number !"1a" #rejected
+Hash "#" a#b
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Case{
+		{2, "Expr", "1+2", false, "3"},
+		{3, "Expr", "[1]", false, "[1]"},
+		{4, "Number", "12", false, ""},
+		{5, "Number", "1a", true, ""},
+		{6, "Hash", "#", false, "a#b"},
+	}
+	if len(cases) != len(want) {
+		t.Fatalf("got %d cases, want %d", len(cases), len(want))
+	}
+	for i, c := range cases {
+		if *c != want[i] {
+			t.Errorf("got %+v, want %+v", *c, want[i])
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	parse := func(rule, src string) (interface{}, error) {
+		if src == "bad" {
+			return nil, errors.New("no match")
+		}
+		return []interface{}{src}, nil
+	}
+	for _, c := range []struct {
+		c    Case
+		fail bool
+	}{
+		{Case{1, "A", "x", false, "[x]"}, false},
+		{Case{1, "A", "x", false, ""}, false},
+		{Case{1, "A", "x", false, "x"}, true},
+		{Case{1, "A", "bad", false, ""}, true},
+		{Case{1, "A", "bad", true, ""}, false},
+		{Case{1, "A", "x", true, ""}, true},
+	} {
+		if err := c.c.Check(parse); (err != nil) != c.fail {
+			t.Errorf("%+v: error %v", c.c, err)
+		}
+	}
+}
+
+// TestRunResult runs Run in a child process, where it fails on a test with a
+// result.
+func TestRunResult(t *testing.T) {
+	if dir := os.Getenv("PEGTEST_DIR"); dir != "" {
+		Run(t, filepath.Join(dir, "a.peg"), filepath.Join(dir, "a.pegtest"))
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "pegtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range map[string]string{
+		"a.peg":     `A = v:"a"+ { return len(v.([]interface{})) }` + "\n",
+		"a.pegtest": "A \"aa\"\nA \"aaa\" 3\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunResult$")
+	cmd.Env = append(os.Environ(), "PEGTEST_DIR="+dir)
+	out, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "a.pegtest:2: result without actions") {
+		t.Errorf("Run passed or failed otherwise: %v\n%s", err, out)
+	}
+}
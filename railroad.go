@@ -0,0 +1,366 @@
+package peg
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"unicode/utf8"
+)
+
+// Sizes of railroad diagrams in pixels.
+const (
+	rrCharWidth = 8
+	rrPad       = 10 // horizontal padding of text in boxes
+	rrHeight    = 22 // height of boxes
+	rrArc       = 10 // radius of arcs
+	rrGap       = 10 // space between items and around groups
+	rrLabel     = 14 // height of labels of groups
+	rrMargin    = 20
+)
+
+const railroadStyle = `
+svg.railroad path { stroke: #333; stroke-width: 2; fill: none; }
+svg.railroad rect { stroke: #333; stroke-width: 2; fill: #ffc; }
+svg.railroad rect.nonterminal { fill: #dfe; }
+svg.railroad rect.group { stroke: #999; stroke-width: 1; stroke-dasharray: 4; fill: none; }
+svg.railroad text { font: 13px monospace; text-anchor: middle; dominant-baseline: central; }
+svg.railroad text.comment { font-style: italic; fill: #666; }
+svg.railroad text.label { font-size: 11px; text-anchor: start; fill: #666; }
+svg.railroad a text { fill: #06c; }
+`
+
+// rrNode is a part of a railroad diagram, entered on the left and exited on
+// the right of its baseline. up and down are its heights above and below the
+// baseline.
+type rrNode interface {
+	size() (width, up, down int)
+	draw(out io.Writer, x, y int)
+}
+
+// rrBox is a terminal or a nonterminal.
+type rrBox struct {
+	text     string
+	terminal bool
+	href     string
+}
+
+func (b *rrBox) size() (int, int, int) {
+	return utf8.RuneCountInString(b.text)*rrCharWidth + 2*rrPad, rrHeight / 2, rrHeight / 2
+}
+
+func (b *rrBox) draw(out io.Writer, x, y int) {
+	w, up, _ := b.size()
+	class, rx := "nonterminal", 0
+	if b.terminal {
+		class, rx = "terminal", rrHeight/2
+	}
+	if b.href != "" {
+		fmt.Fprintf(out, "<a href=\"%s\">", html.EscapeString(b.href))
+	}
+	fmt.Fprintf(out, "<rect class=\"%s\" x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"%d\"/>", class, x, y-up, w, rrHeight, rx)
+	fmt.Fprintf(out, "<text x=\"%d\" y=\"%d\">%s</text>", x+w/2, y, html.EscapeString(b.text))
+	if b.href != "" {
+		fmt.Fprint(out, "</a>")
+	}
+	fmt.Fprintln(out)
+}
+
+// rrComment is text on the line, for expressions matching nothing.
+type rrComment string
+
+func (c rrComment) size() (int, int, int) {
+	return utf8.RuneCountInString(string(c))*rrCharWidth + 2*rrPad, rrHeight / 2, rrHeight / 2
+}
+
+func (c rrComment) draw(out io.Writer, x, y int) {
+	w, _, _ := c.size()
+	rrLine(out, "M%d %dh%d", x, y, w)
+	fmt.Fprintf(out, "<text class=\"comment\" x=\"%d\" y=\"%d\">%s</text>\n", x+w/2, y-rrHeight/2, html.EscapeString(string(c)))
+}
+
+// rrSkip is an empty line.
+type rrSkip struct{}
+
+func (rrSkip) size() (int, int, int)        { return 0, 0, 0 }
+func (rrSkip) draw(out io.Writer, x, y int) {}
+
+type rrSeq []rrNode
+
+func (s rrSeq) size() (width, up, down int) {
+	for i, n := range s {
+		w, u, d := n.size()
+		if i > 0 {
+			width += rrGap
+		}
+		width += w
+		up = maxInt(up, u)
+		down = maxInt(down, d)
+	}
+	return
+}
+
+func (s rrSeq) draw(out io.Writer, x, y int) {
+	for i, n := range s {
+		if i > 0 {
+			rrLine(out, "M%d %dh%d", x, y, rrGap)
+			x += rrGap
+		}
+		n.draw(out, x, y)
+		w, _, _ := n.size()
+		x += w
+	}
+}
+
+// rrChoice has items[main] on the baseline, items before it above and items
+// after it below.
+type rrChoice struct {
+	items []rrNode
+	main  int
+}
+
+// layout returns offsets of baselines of items.
+func (c *rrChoice) layout() (width int, offsets []int, up, down int) {
+	offsets = make([]int, len(c.items))
+	for _, n := range c.items {
+		w, _, _ := n.size()
+		width = maxInt(width, w)
+	}
+	width += 4 * rrArc
+
+	_, up, down = c.items[c.main].size()
+
+	dy, prev := 0, down
+	for i := c.main + 1; i < len(c.items); i++ {
+		_, u, d := c.items[i].size()
+		dy += maxInt(prev+rrGap+u, 2*rrArc)
+		offsets[i] = dy
+		down, prev = dy+d, d
+	}
+
+	dy, prev = 0, up
+	for i := c.main - 1; i >= 0; i-- {
+		_, u, d := c.items[i].size()
+		dy += maxInt(prev+rrGap+d, 2*rrArc)
+		offsets[i] = -dy
+		up, prev = dy+u, u
+	}
+
+	return
+}
+
+func (c *rrChoice) size() (int, int, int) {
+	width, _, up, down := c.layout()
+	return width, up, down
+}
+
+func (c *rrChoice) draw(out io.Writer, x, y int) {
+	width, offsets, _, _ := c.layout()
+	r := rrArc
+	for i, n := range c.items {
+		w, _, _ := n.size()
+		dy := offsets[i]
+		ix, end := x+2*r, x+width-2*r
+		switch {
+		case dy == 0:
+			rrLine(out, "M%d %dh%d", x, y, 2*r)
+			rrLine(out, "M%d %dH%d", ix+w, y, x+width)
+		case dy > 0:
+			rrLine(out, "M%d %da%d %d 0 0 1 %d %dv%da%d %d 0 0 0 %d %d", x, y, r, r, r, r, dy-2*r, r, r, r, r)
+			rrLine(out, "M%d %dH%da%d %d 0 0 0 %d %dv%da%d %d 0 0 1 %d %d", ix+w, y+dy, end, r, r, r, -r, 2*r-dy, r, r, r, -r)
+		default:
+			rrLine(out, "M%d %da%d %d 0 0 0 %d %dv%da%d %d 0 0 1 %d %d", x, y, r, r, r, -r, dy+2*r, r, r, r, -r)
+			rrLine(out, "M%d %dH%da%d %d 0 0 1 %d %dv%da%d %d 0 0 0 %d %d", ix+w, y+dy, end, r, r, r, r, -dy-2*r, r, r, r, r)
+		}
+		n.draw(out, ix, y+dy)
+	}
+}
+
+// rrLoop is item repeated through a line below it.
+type rrLoop struct {
+	item rrNode
+}
+
+func (l *rrLoop) size() (int, int, int) {
+	w, u, d := l.item.size()
+	return w + 2*rrArc, u, maxInt(d+rrGap, 2*rrArc)
+}
+
+func (l *rrLoop) draw(out io.Writer, x, y int) {
+	w, _, dy := l.size()
+	r := rrArc
+	rrLine(out, "M%d %dh%d", x, y, r)
+	l.item.draw(out, x+r, y)
+	rrLine(out, "M%d %dH%d", x+w-r, y, x+w)
+	rrLine(out, "M%d %da%d %d 0 0 1 %d %dv%da%d %d 0 0 1 %d %dH%da%d %d 0 0 1 %d %dv%da%d %d 0 0 1 %d %d",
+		x+w-r, y, r, r, r, r, dy-2*r, r, r, -r, r, x+r, r, r, -r, -r, 2*r-dy, r, r, r, -r)
+}
+
+// rrGroup is item in a dashed box with a label, for predicates.
+type rrGroup struct {
+	item  rrNode
+	label string
+}
+
+func (g *rrGroup) size() (int, int, int) {
+	w, u, d := g.item.size()
+	w = maxInt(w, utf8.RuneCountInString(g.label)*rrCharWidth)
+	return w + 2*rrGap, u + rrGap + rrLabel, d + rrGap
+}
+
+func (g *rrGroup) draw(out io.Writer, x, y int) {
+	w, _, _ := g.size()
+	iw, iu, id := g.item.size()
+	top := y - iu - rrGap
+	fmt.Fprintf(out, "<rect class=\"group\" x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\"/>\n", x, top, w, iu+id+2*rrGap)
+	fmt.Fprintf(out, "<text class=\"label\" x=\"%d\" y=\"%d\">%s</text>\n", x, top-rrLabel/2, html.EscapeString(g.label))
+	rrLine(out, "M%d %dh%d", x, y, rrGap)
+	g.item.draw(out, x+rrGap, y)
+	rrLine(out, "M%d %dH%d", x+rrGap+iw, y, x+w)
+}
+
+func rrLine(out io.Writer, format string, a ...interface{}) {
+	fmt.Fprintf(out, "<path d=\"%s\"/>\n", fmt.Sprintf(format, a...))
+}
+
+// railroad converts expressions to railroad diagrams.
+type railroad struct {
+	links bool // link references to rules in an HTML page
+}
+
+func (rr *railroad) choiceExpr(ce *ChoiceExpr) rrNode {
+	if len(ce.ActionExprs) == 1 {
+		return rr.seqExpr(ce.ActionExprs[0].SeqExpr)
+	}
+	c := &rrChoice{}
+	for _, ae := range ce.ActionExprs {
+		c.items = append(c.items, rr.seqExpr(ae.SeqExpr))
+	}
+	return c
+}
+
+func (rr *railroad) seqExpr(se *SeqExpr) rrNode {
+	s := rrSeq{}
+	for _, le := range se.LabeledExprs {
+		s = append(s, rr.prefixedExpr(le.PrefixedExpr))
+	}
+	if len(s) == 1 {
+		return s[0]
+	}
+	return s
+}
+
+func (rr *railroad) prefixedExpr(pe *PrefixedExpr) rrNode {
+	if _, ok := pe.SuffixedExpr.PrimaryExpr.Expr.(*CodeExpr); ok {
+		return rrComment(pe.PrefixOp.String() + "{…}")
+	}
+
+	n := rr.suffixedExpr(pe.SuffixedExpr)
+	switch pe.PrefixOp {
+	case AND:
+		return &rrGroup{n, "followed by"}
+	case NOT:
+		return &rrGroup{n, "not followed by"}
+	}
+	return n
+}
+
+func (rr *railroad) suffixedExpr(se *SuffixedExpr) rrNode {
+	n := rr.primaryExpr(se.PrimaryExpr)
+	switch se.SuffixOp {
+	case QUESTION:
+		return &rrChoice{[]rrNode{rrSkip{}, n}, 1}
+	case STAR:
+		return &rrChoice{[]rrNode{rrSkip{}, &rrLoop{n}}, 1}
+	case PLUS:
+		return &rrLoop{n}
+	}
+	return n
+}
+
+func (rr *railroad) primaryExpr(pe *PrimaryExpr) rrNode {
+	switch e := pe.Expr.(type) {
+	case *LitMatcher:
+		return &rrBox{text: fmt.Sprintf("%q", e.Lit), terminal: true}
+	case *ClassMatcher:
+		return &rrBox{text: e.Class.String(), terminal: true}
+	case *KindMatcher:
+		return &rrBox{text: "@" + e.Kind, terminal: true}
+	case *AnyMatcher:
+		return &rrBox{text: ".", terminal: true}
+	case *RuleRef:
+		return rr.ruleRef(e.Name)
+	case *SubExpr:
+		return rr.choiceExpr(e.ChoiceExpr)
+	case *RecoverExpr:
+		return &rrGroup{rr.ruleRef(e.Rule), "recover"}
+	case *ThrowExpr:
+		return rrComment(fmt.Sprintf("^%q", e.Msg))
+	case *StateCodeExpr:
+		return rrComment("%{…}")
+	case *IndentExpr:
+		return &rrBox{text: e.Type.String(), terminal: true}
+	}
+	panic(fmt.Sprintf("unknown expression %T", pe.Expr))
+}
+
+func (rr *railroad) ruleRef(name string) rrNode {
+	b := &rrBox{text: name}
+	if rr.links {
+		b.href = "#" + name
+	}
+	return b
+}
+
+// genDiagram writes n as an SVG element, with style if standalone.
+func genDiagram(out io.Writer, n rrNode, standalone bool) {
+	w, up, down := n.size()
+	width := w + 2*rrGap + 2*rrMargin
+	height := up + down + 2*rrMargin
+	x, y := rrMargin, rrMargin+up
+
+	fmt.Fprintf(out, "<svg class=\"railroad\" xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", width, height, width, height)
+	if standalone {
+		fmt.Fprintf(out, "<style>%s</style>\n", railroadStyle)
+	}
+	rrLine(out, "M%d %dv%dm0 %dh%d", x, y-rrHeight/2, rrHeight, -rrHeight/2, rrGap)
+	n.draw(out, x+rrGap, y)
+	rrLine(out, "M%d %dh%dm0 %dv%d", x+rrGap+w, y, rrGap, -rrHeight/2, rrHeight)
+	fmt.Fprintln(out, "</svg>")
+}
+
+// GenRailroadSVG writes the railroad diagram of r as an SVG document.
+func (r *Rule) GenRailroadSVG(out io.Writer) {
+	Upgrade(r)
+	genDiagram(out, (&railroad{}).choiceExpr(r.ChoiceExpr), true)
+}
+
+// GenRailroadHTML writes an HTML page with the railroad diagram of each rule,
+// in which references to rules link to their diagrams.
+func (tree *Tree) GenRailroadHTML(out io.Writer) {
+	Upgrade(tree)
+	rr := &railroad{links: true}
+
+	fmt.Fprintln(out, "<!DOCTYPE html>")
+	fmt.Fprintln(out, "<html>\n<head>\n<meta charset=\"utf-8\">")
+	fmt.Fprintf(out, "<title>%s</title>\n", html.EscapeString(tree.Package))
+	fmt.Fprintf(out, "<style>%s</style>\n", railroadStyle)
+	fmt.Fprintln(out, "</head>\n<body>")
+
+	for _, r := range tree.RuleList {
+		fmt.Fprintf(out, "<h2 id=\"%[1]s\"><a href=\"#%[1]s\">%[1]s</a></h2>\n", r.Name)
+		genDiagram(out, rr.choiceExpr(r.ChoiceExpr), false)
+	}
+	if tree.Skip != nil {
+		io.WriteString(out, "<h2>%skip</h2>\n")
+		genDiagram(out, rr.choiceExpr(tree.Skip), false)
+	}
+
+	fmt.Fprintln(out, "</body>\n</html>")
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -13,7 +13,7 @@ type Scanner struct {
 	start  int
 	end    int
 
-	line int
+	line int // position of current character
 	col  int
 	char rune // current character
 	next rune // next character
@@ -35,13 +35,22 @@ func NewScanner(reader io.Reader, bufsize int) *Scanner {
 }
 
 func (s *Scanner) Scan() (token Token) {
+	defer func() {
+		if token.Type == EOF {
+			token.End = token.Pos
+		} else {
+			token.End = Pos{Line: s.line, Col: s.col + 1}
+		}
+	}()
+
 Next:
 	s.nextChar()
 
+	tt := s.skipSpace()
+
 	token.Pos.Line = s.line
 	token.Pos.Col = s.col
 
-	tt := s.skipSpace()
 	if tt == EOF {
 		token.Type = tt
 		return
@@ -78,12 +87,14 @@ Next:
 		literal := []rune{}
 		for {
 			s.nextChar()
+			s.expectMore("string", token.Pos)
 			if s.char == '"' {
 				token.Type = STRING
 				token.Literal = literal
 				return
 			} else if s.char == '\\' {
 				s.nextChar()
+				s.expectMore("string", token.Pos)
 				literal = append(literal, unescape(s.char))
 			} else {
 				literal = append(literal, s.char)
@@ -93,6 +104,7 @@ Next:
 		literal := []rune{s.char}
 		for {
 			s.nextChar()
+			s.expectMore("character class", token.Pos)
 			if s.char == ']' {
 				literal = append(literal, ']')
 				token.Type = RANGE
@@ -106,23 +118,26 @@ Next:
 			}
 		}
 	case '{':
+		token.Type = CODE
+		token.Literal = s.scanCode(token.Pos)
+	case '%':
+		if s.peekChar() == '{' {
+			s.nextChar()
+			token.Type = STATECODE
+			token.Literal = s.scanCode(token.Pos)
+			return
+		}
+
 		literal := []rune{}
-		depth := 0
-		for {
+		for isIdentContChar(s.peekChar()) {
 			s.nextChar()
-			if s.char == '{' {
-				depth++
-			} else if s.char == '}' && (len(literal) == 0 || literal[len(literal)-1] != '\\') {
-				if depth == 0 {
-					break
-				} else {
-					depth--
-				}
-			}
 			literal = append(literal, s.char)
 		}
-		token.Type = CODE
-		token.Literal = literal
+		if tt := isDirective(literal); tt != NONE {
+			token.Type = tt
+		} else {
+			panic(fmt.Sprintf("%d:%d: %q invalid directive", token.Pos.Line, token.Pos.Col, "%"+string(literal)))
+		}
 	case '.':
 		token.Type = DOT
 	case '=':
@@ -145,12 +160,53 @@ Next:
 		token.Type = NOT
 	case '/':
 		token.Type = SLASH
+	case '^':
+		token.Type = CARET
+	case '@':
+		literal := []rune{}
+		for isIdentContChar(s.peekChar()) {
+			s.nextChar()
+			literal = append(literal, s.char)
+		}
+		if len(literal) == 0 {
+			panic(fmt.Sprintf("%d:%d: %q invalid token kind", token.Pos.Line, token.Pos.Col, "@"))
+		}
+		token.Type = KIND
+		token.Literal = literal
 	default:
-		panic(fmt.Sprintf("%q invalid character", s.char))
+		panic(fmt.Sprintf("%d:%d: %q invalid character", token.Pos.Line, token.Pos.Col, s.char))
 	}
 	return
 }
 
+// scanCode returns code between '{' (current character) and matching '}'.
+func (s *Scanner) scanCode(pos Pos) []rune {
+	literal := []rune{}
+	depth := 0
+	for {
+		s.nextChar()
+		s.expectMore("code", pos)
+		if s.char == '{' {
+			depth++
+		} else if s.char == '}' && (len(literal) == 0 || literal[len(literal)-1] != '\\') {
+			if depth == 0 {
+				break
+			} else {
+				depth--
+			}
+		}
+		literal = append(literal, s.char)
+	}
+	return literal
+}
+
+// expectMore panics if input of the token at pos ends.
+func (s *Scanner) expectMore(what string, pos Pos) {
+	if s.char == utf8.RuneError {
+		panic(fmt.Sprintf("%d:%d: unterminated %s", pos.Line, pos.Col, what))
+	}
+}
+
 func (s *Scanner) fillBuf() {
 	if s.start > 0 {
 		copy(s.buf, s.buf[s.start:s.end])
@@ -192,10 +248,12 @@ func (s *Scanner) nextChar() {
 		}
 	}
 
-	if isNewline(s.next) {
+	switch {
+	case s.char == 0, s.char == '\r' && s.next == '\n':
+	case isNewline(s.char):
 		s.line += 1
 		s.col = 1
-	} else {
+	default:
 		s.col += 1
 	}
 
@@ -0,0 +1,1329 @@
+// Code generated by PEG.go from json.peg. DO NOT EDIT.
+
+// This parser was generated before character classes were matched with
+// bitmaps and switches, and choices of literals with a switch on the first
+// character, and before recognizer-only code for discarded values.
+// BenchmarkJSON measures it as the baseline of the closure backend.
+
+package parser
+
+import "bytes"
+import "errors"
+import "fmt"
+import "reflect"
+import "strconv"
+
+var pegErr = errors.New("PEG ERROR")
+
+func Parse(src []rune) (interface{}, error) {
+	return NewParser(src).Parse()
+}
+
+type Parser struct {
+	src []rune
+	p   *parser
+}
+
+func NewParser(src []rune) *Parser {
+	return &Parser{src: src}
+}
+
+func (p *Parser) Parse() (interface{}, error) {
+	p.p = newParser(p.src)
+	return p.p.rule_JSON()
+}
+
+func (__p *parser) advance(n int) {
+	__p.n += n
+}
+
+func (__p *parser) backTo(n int) {
+	__p.n = n
+}
+
+func (__p *parser) expectDot(advance bool) (interface{}, error) {
+	if __p.n < len(__p.src) {
+		r := string(__p.src[__p.n])
+		if advance {
+			__p.advance(1)
+		}
+		return r, nil
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) expectString(advance bool, str string, l int) (interface{}, error) {
+	if __p.n+l <= len(__p.src) && str == string(__p.src[__p.n:__p.n+l]) {
+		if advance {
+			__p.advance(l)
+		}
+		return str, nil
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) expectChar(advance bool, chars ...rune) (interface{}, error) {
+	if __p.n < len(__p.src) {
+		c := __p.src[__p.n]
+		for i := 0; i < len(chars); i += 2 {
+			if chars[i] <= c && c <= chars[i+1] {
+				if advance {
+					__p.advance(1)
+				}
+				return string(c), nil
+			}
+		}
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) expectCharNot(advance bool, chars ...rune) (interface{}, error) {
+	if __p.n < len(__p.src) {
+		c := __p.src[__p.n]
+		for i := 0; i < len(chars); i += 2 {
+			if chars[i] <= c && c <= chars[i+1] {
+				return nil, pegErr
+			}
+		}
+		if advance {
+			__p.advance(1)
+		}
+		return string(c), nil
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) zeroOrOne(pe func() (interface{}, error)) (interface{}, error) {
+	if r, err := pe(); err == nil {
+		return r, nil
+	}
+	return nil, nil
+}
+
+func (__p *parser) oneOrMore(pe func() (interface{}, error)) (interface{}, error) {
+	var ret []interface{}
+	if r, err := pe(); err == nil {
+		ret = []interface{}{r}
+	} else {
+		return nil, pegErr
+	}
+	for {
+		if r, err := pe(); err == nil {
+			ret = append(ret, r)
+		} else {
+			break
+		}
+	}
+	if len(ret) > 0 {
+		return ret, nil
+	} else {
+		return nil, pegErr
+	}
+}
+
+func (__p *parser) zeroOrMore(pe func() (interface{}, error)) (interface{}, error) {
+	ret := []interface{}{}
+	for {
+		if r, err := pe(); err == nil {
+			ret = append(ret, r)
+		} else {
+			break
+		}
+	}
+	return ret, nil
+}
+
+func String(r interface{}) string {
+	if r == nil {
+		return ""
+	}
+
+	switch reflect.TypeOf(r).Kind() {
+	case reflect.Array:
+		fallthrough
+	case reflect.Slice:
+		buf := &bytes.Buffer{}
+		v := reflect.ValueOf(r)
+		for i := 0; i < v.Len(); i++ {
+			buf.WriteString(String(v.Index(i).Interface()))
+		}
+		return buf.String()
+	default:
+		return fmt.Sprint(r)
+	}
+
+	return ""
+}
+
+func RuneSlice(r interface{}) []rune {
+	return []rune(String(r))
+}
+
+type parser struct {
+	src []rune
+	n   int
+}
+
+func newParser(src []rune) *parser {
+	__p := &parser{src: src}
+	return __p
+}
+
+func (__p *parser) rule_JSON() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		if _, err := func() (interface{}, error) {
+			return __p.rule__()
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		var v interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.rule_Value()
+			return nil, pegErr
+		}(); err == nil {
+			v = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		if _, err := func() (interface{}, error) {
+			return __p.expectDot(false)
+			return nil, pegErr
+		}(); err != nil {
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_0(v), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_Value() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var v interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_n := __p.n
+			if __ae_ret, err := func() (interface{}, error) {
+				var __peg_v0 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					return __p.rule_Object()
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v0 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				return __peg_v0, nil
+			}(); err == nil {
+				return __ae_ret, nil
+			} else {
+				__p.backTo(__peg_n)
+			}
+			if __ae_ret, err := func() (interface{}, error) {
+				var __peg_v0 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					return __p.rule_Array()
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v0 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				return __peg_v0, nil
+			}(); err == nil {
+				return __ae_ret, nil
+			} else {
+				__p.backTo(__peg_n)
+			}
+			if __ae_ret, err := func() (interface{}, error) {
+				var __peg_v0 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					return __p.rule_String()
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v0 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				return __peg_v0, nil
+			}(); err == nil {
+				return __ae_ret, nil
+			} else {
+				__p.backTo(__peg_n)
+			}
+			if __ae_ret, err := func() (interface{}, error) {
+				var __peg_v0 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					return __p.rule_Number()
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v0 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				return __peg_v0, nil
+			}(); err == nil {
+				return __ae_ret, nil
+			} else {
+				__p.backTo(__peg_n)
+			}
+			if __ae_ret, err := func() (interface{}, error) {
+				var __peg_v0 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					return __p.rule_Literal()
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v0 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				return __peg_v0, nil
+			}(); err == nil {
+				return __ae_ret, nil
+			} else {
+				__p.backTo(__peg_n)
+			}
+			return nil, pegErr
+		}(); err == nil {
+			v = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		if _, err := func() (interface{}, error) {
+			return __p.rule__()
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_1(v), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_Object() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		if _, err := func() (interface{}, error) {
+			return __p.expectString(true, "{", 1)
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		if _, err := func() (interface{}, error) {
+			return __p.rule__()
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		var ms interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_pe := func() (interface{}, error) {
+				return __p.rule_Members()
+				return nil, pegErr
+			}
+			return __p.zeroOrOne(__peg_pe)
+			return nil, pegErr
+		}(); err == nil {
+			ms = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		if _, err := func() (interface{}, error) {
+			return __p.expectString(true, "}", 1)
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_2(ms), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_Members() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var first interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.rule_Member()
+			return nil, pegErr
+		}(); err == nil {
+			first = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		var rest interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_pe := func() (interface{}, error) {
+				__peg_n := __p.n
+				if __ae_ret, err := func() (interface{}, error) {
+					if _, err := func() (interface{}, error) {
+						return __p.expectString(true, ",", 1)
+						return nil, pegErr
+					}(); err == nil {
+					} else {
+						return nil, pegErr
+					}
+					if _, err := func() (interface{}, error) {
+						return __p.rule__()
+						return nil, pegErr
+					}(); err == nil {
+					} else {
+						return nil, pegErr
+					}
+					var m interface{}
+					if __pe_ret, err := func() (interface{}, error) {
+						return __p.rule_Member()
+						return nil, pegErr
+					}(); err == nil {
+						m = __pe_ret
+					} else {
+						return nil, pegErr
+					}
+					return __p.ae_code_3(m), nil
+				}(); err == nil {
+					return __ae_ret, nil
+				} else {
+					__p.backTo(__peg_n)
+				}
+				return nil, pegErr
+			}
+			return __p.zeroOrMore(__peg_pe)
+			return nil, pegErr
+		}(); err == nil {
+			rest = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_4(first, rest), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_Member() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var k interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.rule_String()
+			return nil, pegErr
+		}(); err == nil {
+			k = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		if _, err := func() (interface{}, error) {
+			return __p.rule__()
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		if _, err := func() (interface{}, error) {
+			return __p.expectString(true, ":", 1)
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		if _, err := func() (interface{}, error) {
+			return __p.rule__()
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		var v interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.rule_Value()
+			return nil, pegErr
+		}(); err == nil {
+			v = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_5(k, v), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_Array() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		if _, err := func() (interface{}, error) {
+			return __p.expectString(true, "[", 1)
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		if _, err := func() (interface{}, error) {
+			return __p.rule__()
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		var es interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_pe := func() (interface{}, error) {
+				return __p.rule_Elements()
+				return nil, pegErr
+			}
+			return __p.zeroOrOne(__peg_pe)
+			return nil, pegErr
+		}(); err == nil {
+			es = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		if _, err := func() (interface{}, error) {
+			return __p.expectString(true, "]", 1)
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_6(es), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_Elements() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var first interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.rule_Value()
+			return nil, pegErr
+		}(); err == nil {
+			first = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		var rest interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_pe := func() (interface{}, error) {
+				__peg_n := __p.n
+				if __ae_ret, err := func() (interface{}, error) {
+					if _, err := func() (interface{}, error) {
+						return __p.expectString(true, ",", 1)
+						return nil, pegErr
+					}(); err == nil {
+					} else {
+						return nil, pegErr
+					}
+					if _, err := func() (interface{}, error) {
+						return __p.rule__()
+						return nil, pegErr
+					}(); err == nil {
+					} else {
+						return nil, pegErr
+					}
+					var v interface{}
+					if __pe_ret, err := func() (interface{}, error) {
+						return __p.rule_Value()
+						return nil, pegErr
+					}(); err == nil {
+						v = __pe_ret
+					} else {
+						return nil, pegErr
+					}
+					return __p.ae_code_7(v), nil
+				}(); err == nil {
+					return __ae_ret, nil
+				} else {
+					__p.backTo(__peg_n)
+				}
+				return nil, pegErr
+			}
+			return __p.zeroOrMore(__peg_pe)
+			return nil, pegErr
+		}(); err == nil {
+			rest = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_8(first, rest), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_String() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		if _, err := func() (interface{}, error) {
+			return __p.expectString(true, "\"", 1)
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		var cs interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_pe := func() (interface{}, error) {
+				return __p.rule_Char()
+				return nil, pegErr
+			}
+			return __p.zeroOrMore(__peg_pe)
+			return nil, pegErr
+		}(); err == nil {
+			cs = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		if _, err := func() (interface{}, error) {
+			return __p.expectString(true, "\"", 1)
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_9(cs), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_Char() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		if _, err := func() (interface{}, error) {
+			return __p.expectString(true, "\\", 1)
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		var e interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.rule_Escape()
+			return nil, pegErr
+		}(); err == nil {
+			e = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_10(e), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectCharNot(true, '"', '"', '\\', '\\')
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __peg_v0, nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_Escape() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "\"", 1)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_11(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "\\", 1)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_12(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "/", 1)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_13(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "b", 1)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_14(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "f", 1)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_15(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "n", 1)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_16(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "r", 1)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_17(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "t", 1)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_18(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		if _, err := func() (interface{}, error) {
+			return __p.expectString(true, "u", 1)
+			return nil, pegErr
+		}(); err == nil {
+		} else {
+			return nil, pegErr
+		}
+		var h interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_n := __p.n
+			if __ae_ret, err := func() (interface{}, error) {
+				var __peg_v0 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					return __p.rule_HEX()
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v0 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				var __peg_v1 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					return __p.rule_HEX()
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v1 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				var __peg_v2 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					return __p.rule_HEX()
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v2 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				var __peg_v3 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					return __p.rule_HEX()
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v3 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				return [...]interface{}{__peg_v0, __peg_v1, __peg_v2, __peg_v3}, nil
+			}(); err == nil {
+				return __ae_ret, nil
+			} else {
+				__p.backTo(__peg_n)
+			}
+			return nil, pegErr
+		}(); err == nil {
+			h = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_19(h), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_HEX() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectChar(true, '0', '9', 'a', 'f', 'A', 'F')
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __peg_v0, nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_Number() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var n interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_n := __p.n
+			if __ae_ret, err := func() (interface{}, error) {
+				var __peg_v0 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					__peg_pe := func() (interface{}, error) {
+						return __p.expectString(true, "-", 1)
+						return nil, pegErr
+					}
+					return __p.zeroOrOne(__peg_pe)
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v0 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				var __peg_v1 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					return __p.rule_INT()
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v1 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				var __peg_v2 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					__peg_pe := func() (interface{}, error) {
+						return __p.rule_FRAC()
+						return nil, pegErr
+					}
+					return __p.zeroOrOne(__peg_pe)
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v2 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				var __peg_v3 interface{}
+				if __pe_ret, err := func() (interface{}, error) {
+					__peg_pe := func() (interface{}, error) {
+						return __p.rule_EXP()
+						return nil, pegErr
+					}
+					return __p.zeroOrOne(__peg_pe)
+					return nil, pegErr
+				}(); err == nil {
+					__peg_v3 = __pe_ret
+				} else {
+					return nil, pegErr
+				}
+				return [...]interface{}{__peg_v0, __peg_v1, __peg_v2, __peg_v3}, nil
+			}(); err == nil {
+				return __ae_ret, nil
+			} else {
+				__p.backTo(__peg_n)
+			}
+			return nil, pegErr
+		}(); err == nil {
+			n = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_20(n), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_INT() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "0", 1)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __peg_v0, nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectChar(true, '1', '9')
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		var __peg_v1 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_pe := func() (interface{}, error) {
+				return __p.expectChar(true, '0', '9')
+				return nil, pegErr
+			}
+			return __p.zeroOrMore(__peg_pe)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v1 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return [...]interface{}{__peg_v0, __peg_v1}, nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_FRAC() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, ".", 1)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		var __peg_v1 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_pe := func() (interface{}, error) {
+				return __p.expectChar(true, '0', '9')
+				return nil, pegErr
+			}
+			return __p.oneOrMore(__peg_pe)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v1 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return [...]interface{}{__peg_v0, __peg_v1}, nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_EXP() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectChar(true, 'e', 'e', 'E', 'E')
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		var __peg_v1 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_pe := func() (interface{}, error) {
+				__peg_n := __p.n
+				if __ae_ret, err := func() (interface{}, error) {
+					var __peg_v0 interface{}
+					if __pe_ret, err := func() (interface{}, error) {
+						return __p.expectString(true, "+", 1)
+						return nil, pegErr
+					}(); err == nil {
+						__peg_v0 = __pe_ret
+					} else {
+						return nil, pegErr
+					}
+					return __peg_v0, nil
+				}(); err == nil {
+					return __ae_ret, nil
+				} else {
+					__p.backTo(__peg_n)
+				}
+				if __ae_ret, err := func() (interface{}, error) {
+					var __peg_v0 interface{}
+					if __pe_ret, err := func() (interface{}, error) {
+						return __p.expectString(true, "-", 1)
+						return nil, pegErr
+					}(); err == nil {
+						__peg_v0 = __pe_ret
+					} else {
+						return nil, pegErr
+					}
+					return __peg_v0, nil
+				}(); err == nil {
+					return __ae_ret, nil
+				} else {
+					__p.backTo(__peg_n)
+				}
+				return nil, pegErr
+			}
+			return __p.zeroOrOne(__peg_pe)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v1 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		var __peg_v2 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_pe := func() (interface{}, error) {
+				return __p.expectChar(true, '0', '9')
+				return nil, pegErr
+			}
+			return __p.oneOrMore(__peg_pe)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v2 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return [...]interface{}{__peg_v0, __peg_v1, __peg_v2}, nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule_Literal() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "true", 4)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_21(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "false", 5)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_22(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			return __p.expectString(true, "null", 4)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __p.ae_code_23(__peg_v0), nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func (__p *parser) rule__() (interface{}, error) {
+	__peg_n := __p.n
+	if __ae_ret, err := func() (interface{}, error) {
+		var __peg_v0 interface{}
+		if __pe_ret, err := func() (interface{}, error) {
+			__peg_pe := func() (interface{}, error) {
+				return __p.expectChar(true, ' ', ' ', '\t', '\t', '\r', '\r', '\n', '\n')
+				return nil, pegErr
+			}
+			return __p.zeroOrMore(__peg_pe)
+			return nil, pegErr
+		}(); err == nil {
+			__peg_v0 = __pe_ret
+		} else {
+			return nil, pegErr
+		}
+		return __peg_v0, nil
+	}(); err == nil {
+		return __ae_ret, nil
+	} else {
+		__p.backTo(__peg_n)
+	}
+	return nil, pegErr
+}
+
+func list(v interface{}) []interface{} {
+	if v == nil {
+		return nil
+	}
+	return v.([]interface{})
+}
+func (__p *parser) ae_code_0(v interface{}) (ret interface{}) {
+	return v
+	return
+}
+func (__p *parser) ae_code_1(v interface{}) (ret interface{}) {
+	return v
+	return
+}
+func (__p *parser) ae_code_2(ms interface{}) (ret interface{}) {
+
+	obj := map[string]interface{}{}
+	for _, m := range list(ms) {
+		kv := m.([2]interface{})
+		obj[kv[0].(string)] = kv[1]
+	}
+	return obj
+
+	return
+}
+func (__p *parser) ae_code_3(m interface{}) (ret interface{}) {
+	return m
+	return
+}
+func (__p *parser) ae_code_4(first, rest interface{}) (ret interface{}) {
+
+	return append([]interface{}{first}, list(rest)...)
+
+	return
+}
+func (__p *parser) ae_code_5(k, v interface{}) (ret interface{}) {
+	return [2]interface{}{k, v}
+	return
+}
+func (__p *parser) ae_code_6(es interface{}) (ret interface{}) {
+
+	if es == nil {
+		return []interface{}{}
+	}
+	return es
+
+	return
+}
+func (__p *parser) ae_code_7(v interface{}) (ret interface{}) {
+	return v
+	return
+}
+func (__p *parser) ae_code_8(first, rest interface{}) (ret interface{}) {
+
+	return append([]interface{}{first}, list(rest)...)
+
+	return
+}
+func (__p *parser) ae_code_9(cs interface{}) (ret interface{}) {
+	return String(cs)
+	return
+}
+func (__p *parser) ae_code_10(e interface{}) (ret interface{}) {
+	return e
+	return
+}
+func (__p *parser) ae_code_11(result interface{}) (ret interface{}) {
+	return "\""
+	return
+}
+func (__p *parser) ae_code_12(result interface{}) (ret interface{}) {
+	return "\\"
+	return
+}
+func (__p *parser) ae_code_13(result interface{}) (ret interface{}) {
+	return "/"
+	return
+}
+func (__p *parser) ae_code_14(result interface{}) (ret interface{}) {
+	return "\b"
+	return
+}
+func (__p *parser) ae_code_15(result interface{}) (ret interface{}) {
+	return "\f"
+	return
+}
+func (__p *parser) ae_code_16(result interface{}) (ret interface{}) {
+	return "\n"
+	return
+}
+func (__p *parser) ae_code_17(result interface{}) (ret interface{}) {
+	return "\r"
+	return
+}
+func (__p *parser) ae_code_18(result interface{}) (ret interface{}) {
+	return "\t"
+	return
+}
+func (__p *parser) ae_code_19(h interface{}) (ret interface{}) {
+
+	n, _ := strconv.ParseUint(String(h), 16, 32)
+	return string(rune(n))
+
+	return
+}
+func (__p *parser) ae_code_20(n interface{}) (ret interface{}) {
+
+	f, _ := strconv.ParseFloat(String(n), 64)
+	return f
+
+	return
+}
+func (__p *parser) ae_code_21(result interface{}) (ret interface{}) {
+	return true
+	return
+}
+func (__p *parser) ae_code_22(result interface{}) (ret interface{}) {
+	return false
+	return
+}
+func (__p *parser) ae_code_23(result interface{}) (ret interface{}) {
+	return nil
+	return
+}
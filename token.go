@@ -9,6 +9,7 @@ type Pos struct {
 
 type Token struct {
 	Pos Pos
+	End Pos // position after the token
 
 	Type    TokenType
 	Literal []rune
@@ -48,6 +49,20 @@ const (
 	// keyword
 	PACKAGE // package
 	IMPORT  // import
+
+	RECOVER // %recover
+	CARET   // ^
+
+	STATECODE // %{abc}
+	STATE     // %state
+
+	// indentation, scanned as IDENT
+	INDENT   // INDENT
+	DEDENT   // DEDENT
+	SAMEDENT // SAMEDENT
+
+	SKIP // %skip
+	KIND // @abc
 )
 
 // isKeyword returns corresponding TokenType if literal is keyword or returns NONE
@@ -63,6 +78,21 @@ func isKeyword(literal []rune) TokenType {
 	}
 }
 
+// isDirective returns corresponding TokenType if literal is directive (without '%') or returns NONE
+func isDirective(literal []rune) TokenType {
+	lit := string(literal)
+	switch lit {
+	case "recover":
+		return RECOVER
+	case "state":
+		return STATE
+	case "skip":
+		return SKIP
+	default:
+		return NONE
+	}
+}
+
 func (tt TokenType) String() string {
 	switch tt {
 	case NONE:
@@ -81,6 +111,11 @@ func (tt TokenType) String() string {
 	case DOT:
 		return "."
 
+	case STATECODE:
+		return "STATECODE" // %{abc}
+	case KIND:
+		return "KIND" // @abc
+
 	case ASSIGN:
 		return "="
 	case COLON:
@@ -106,10 +141,27 @@ func (tt TokenType) String() string {
 	case SLASH:
 		return "/"
 
+	case CARET:
+		return "^"
+
 	case PACKAGE:
 		return "package"
 	case IMPORT:
 		return "import"
+
+	case INDENT:
+		return "INDENT"
+	case DEDENT:
+		return "DEDENT"
+	case SAMEDENT:
+		return "SAMEDENT"
+
+	case RECOVER:
+		return "%recover"
+	case STATE:
+		return "%state"
+	case SKIP:
+		return "%skip"
 	}
 	return "Unknown"
 }
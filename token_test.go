@@ -0,0 +1,25 @@
+package peg_test
+
+import (
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+func TestTokenTypeValues(t *testing.T) {
+	// values of the first release, which new token types must not change
+	for i, tt := range []peg.TokenType{
+		peg.NONE, peg.EOF,
+		peg.IDENT, peg.STRING, peg.RANGE, peg.CODE, peg.DOT,
+		peg.ASSIGN, peg.COLON,
+		peg.LPAREN, peg.RPAREN,
+		peg.QUESTION, peg.PLUS, peg.STAR,
+		peg.AND, peg.NOT,
+		peg.SLASH,
+		peg.PACKAGE, peg.IMPORT,
+	} {
+		if int(tt) != i {
+			t.Errorf("%v = %d, want %d", tt, tt, i)
+		}
+	}
+}
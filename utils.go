@@ -1,14 +1,115 @@
 package peg
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
 var BufferSize = 200
 
+// Profile makes generated parsers collect per rule statistics, available
+// through (*Parser).Stats after Parse.
+var Profile = false
+
+// Memoize makes generated parsers cache results of rules by position.
+var Memoize = false
+
+// TokenInput makes generated parsers match a []Token of the generated
+// package instead of []rune. Terminals match tokens by kind (@KIND) or text.
+var TokenInput = false
+
+// Coverage makes Compile, and parsers generated with VMBackend, count matches
+// of rules, alternatives and repetitions in Program.Cover. It is not supported
+// by the closure backend.
+var Coverage = false
+
+// VMBackend makes GenerateParser generate a parser running on the VM instead
+// of nested closures. Profile is not supported by the VM backend.
+var VMBackend = false
+
 func GenerateParser(r io.Reader, w io.Writer) {
+	tree := readTree(r)
+
+	// Generate parser
+	if VMBackend {
+		errs := CheckVM(tree)
+		if Profile {
+			errs = append(errs, errors.New("Profile is not supported by the VM backend"))
+		}
+		if Memoize {
+			errs = append(errs, errors.New("Memoize is not supported by the VM backend"))
+		}
+		abort(errs)
+		tree.GenVMCode(os.Stdout)
+	} else {
+		if Coverage {
+			abort([]error{errors.New("Coverage is only supported by the VM backend")})
+		}
+		tree.GenCode(os.Stdout)
+	}
+}
+
+// GenerateRailroad writes an HTML page with railroad diagrams of rules of the
+// grammar read from r to w.
+func GenerateRailroad(r io.Reader, w io.Writer) {
+	readTree(r).GenRailroadHTML(w)
+}
+
+// GenerateExport writes the grammar read from r in format to w. Warnings of
+// Export are printed to stderr.
+func GenerateExport(r io.Reader, w io.Writer, format Format) {
+	for _, err := range readTree(r).Export(w, format) {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// readTree reads a grammar from r and checks it.
+func readTree(r io.Reader) *Tree {
+	// Get AST from tokens
+	tree := GetTree(scanTokens(r))
+
+	// Check AST
+	abort(Check(tree))
+
+	return tree
+}
+
+// abort prints errs and panics, if there are any, before anything is written.
+func abort(errs []error) {
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		panic(fmt.Sprintf("%d errors. Abort.", len(errs)))
+	}
+}
+
+// ReadTree reads a grammar from r and checks it like GenerateParser, but
+// returns errors instead of panicking.
+func ReadTree(r io.Reader) (tree *Tree, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			tree, err = nil, fmt.Errorf("%v", e)
+		}
+	}()
+
+	tree = GetTree(scanTokens(r))
+
+	if errs := Check(tree); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Error()
+		}
+		return nil, errors.New(strings.Join(msgs, "\n"))
+	}
+
+	return tree, nil
+}
+
+func scanTokens(r io.Reader) []*Token {
 	// New scanner with buffer size
 	scanner := NewScanner(r, BufferSize)
 
@@ -22,18 +123,5 @@ func GenerateParser(r io.Reader, w io.Writer) {
 		}
 	}
 
-	// Get AST from tokens
-	tree := GetTree(tokens)
-
-	// Check AST
-	errors := Check(tree)
-	if len(errors) > 0 {
-		for _, err := range errors {
-			fmt.Fprintln(os.Stderr, err)
-		}
-		panic(fmt.Sprintf("%d errors. Abort.", len(errors)))
-	}
-
-	// Generate parser
-	tree.GenCode(os.Stdout)
+	return tokens
 }
@@ -0,0 +1,363 @@
+package peg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+var (
+	ErrNoMatch       = errors.New("PEG ERROR")
+	ErrMaxDepth      = errors.New("maximum recursion depth exceeded")
+	ErrMaxBacktracks = errors.New("maximum backtrack steps exceeded")
+)
+
+type Op uint8
+
+const (
+	OpChar          Op = iota // match a character in Classes[Arg]
+	OpAny                     // match any character
+	OpString                  // match Strings[Arg]
+	OpChoice                  // push a backtrack entry to Arg
+	OpCommit                  // pop a backtrack entry, jump to Arg
+	OpPartialCommit           // update the top backtrack entry, jump to Arg
+	OpBackCommit              // pop a backtrack entry restoring position, jump to Arg
+	OpFail                    // backtrack
+	OpFailTwice               // pop a backtrack entry and backtrack
+	OpJump                    // jump to Arg
+	OpCall                    // call rule at Arg
+	OpReturn                  // return from rule
+	OpCapture                 // replace N values with the result of action Arg
+	OpPredicate               // call action Arg with N values, fail unless it returns true
+	OpPushNil                 // push nil
+	OpPushList                // push an empty list
+	OpList                    // wrap the top value in a list
+	OpAppend                  // append the top value to the list below it
+	OpCover                   // count a match of Cover[Arg]
+	OpEnd                     // match succeeded
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpChar:
+		return "char"
+	case OpAny:
+		return "any"
+	case OpString:
+		return "string"
+	case OpChoice:
+		return "choice"
+	case OpCommit:
+		return "commit"
+	case OpPartialCommit:
+		return "partialcommit"
+	case OpBackCommit:
+		return "backcommit"
+	case OpFail:
+		return "fail"
+	case OpFailTwice:
+		return "failtwice"
+	case OpJump:
+		return "jump"
+	case OpCall:
+		return "call"
+	case OpReturn:
+		return "return"
+	case OpCapture:
+		return "capture"
+	case OpPredicate:
+		return "predicate"
+	case OpPushNil:
+		return "pushnil"
+	case OpPushList:
+		return "pushlist"
+	case OpList:
+		return "list"
+	case OpAppend:
+		return "append"
+	case OpCover:
+		return "cover"
+	case OpEnd:
+		return "end"
+	}
+	return "Unknown"
+}
+
+type Inst struct {
+	Op  Op
+	Arg int
+	N   int
+}
+
+func (i Inst) String() string {
+	switch i.Op {
+	case OpCapture, OpPredicate:
+		return fmt.Sprintf("%v %d %d", i.Op, i.Arg, i.N)
+	case OpChar, OpString, OpChoice, OpCommit, OpPartialCommit, OpBackCommit, OpJump, OpCall, OpCover:
+		return fmt.Sprintf("%v %d", i.Op, i.Arg)
+	}
+	return i.Op.String()
+}
+
+// Program is a grammar compiled by Compile.
+type Program struct {
+	Insts   []Inst
+	Strings []string
+	Classes []*CharRange
+	Rules   map[string]int // entry of each rule
+	Cover   []*CoverBlock  // blocks counted if compiled with Coverage
+}
+
+// Action computes the value of action n from values of its sequence. For a
+// semantic predicate it returns whether the predicate holds.
+type Action func(n int, v []interface{}) interface{}
+
+// Limits bounds a run of the VM. Zero means no limit.
+type Limits struct {
+	MaxDepth      int // rule recursion depth
+	MaxBacktracks int
+}
+
+// checkInterval is the number of instructions between checks of cancellation.
+const checkInterval = 1 << 12
+
+type frame struct {
+	pc   int
+	pos  int
+	vals int
+	call bool
+}
+
+// Run matches src from the first rule of the grammar. If actions is nil,
+// captures produce nil.
+func (prog *Program) Run(src []rune, actions Action) (interface{}, error) {
+	return prog.RunContext(context.Background(), src, actions, Limits{})
+}
+
+// RunContext is like Run but stops with ctx.Err() when ctx is done, or with
+// ErrMaxDepth or ErrMaxBacktracks when limits are exceeded.
+func (prog *Program) RunContext(ctx context.Context, src []rune, actions Action, limits Limits) (interface{}, error) {
+	vm := &vm{prog: prog, ctx: ctx, limits: limits}
+	return vm.exec(0, nil, src, actions)
+}
+
+// RunRule matches src from rule.
+func (prog *Program) RunRule(rule string, src []rune, actions Action) (interface{}, error) {
+	v, _, err := prog.MatchRule(rule, src, actions)
+	return v, err
+}
+
+// MatchRule is like RunRule but also returns the number of characters
+// matched.
+func (prog *Program) MatchRule(rule string, src []rune, actions Action) (interface{}, int, error) {
+	entry, ok := prog.Rules[rule]
+	if !ok {
+		return nil, 0, fmt.Errorf("Rule %q undefined", rule)
+	}
+	stack := []frame{{pc: -1, call: true}}
+	vm := &vm{prog: prog, ctx: context.Background()}
+	v, err := vm.exec(entry, stack, src, actions)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, vm.end, nil
+}
+
+type vm struct {
+	prog    *Program
+	ctx     context.Context
+	limits  Limits
+	end     int           // position after a match
+	strings []interface{} // Strings of prog boxed on first match
+}
+
+// charValues are the values of matched ASCII characters, boxed once so that
+// matching them does not allocate.
+var charValues [utf8.RuneSelf]interface{}
+
+func init() {
+	for c := range charValues {
+		charValues[c] = string(rune(c))
+	}
+}
+
+// charValue returns the value of the matched character c.
+func charValue(c rune) interface{} {
+	if 0 <= c && c < utf8.RuneSelf {
+		return charValues[c]
+	}
+	return string(c)
+}
+
+func (vm *vm) exec(pc int, stack []frame, src []rune, actions Action) (interface{}, error) {
+	prog := vm.prog
+	vals := []interface{}{}
+	pos := 0
+	depth := 0
+	backtracks := 0
+	done := vm.ctx.Done()
+	vm.strings = make([]interface{}, len(prog.Strings))
+
+	for steps := 1; ; steps++ {
+		if pc < 0 {
+			// returned from the entry rule
+			vm.end = pos
+			return vals[len(vals)-1], nil
+		}
+
+		if done != nil && steps%checkInterval == 0 {
+			select {
+			case <-done:
+				return nil, vm.ctx.Err()
+			default:
+			}
+		}
+
+		inst := prog.Insts[pc]
+		switch inst.Op {
+		case OpChar:
+			if pos < len(src) && prog.Classes[inst.Arg].Match(src[pos]) {
+				vals = append(vals, charValue(src[pos]))
+				pos++
+				pc++
+				continue
+			}
+			goto Fail
+		case OpAny:
+			if pos < len(src) {
+				vals = append(vals, charValue(src[pos]))
+				pos++
+				pc++
+				continue
+			}
+			goto Fail
+		case OpString:
+			str := prog.Strings[inst.Arg]
+			if l, ok := hasPrefix(src[pos:], str); ok {
+				if vm.strings[inst.Arg] == nil {
+					vm.strings[inst.Arg] = str
+				}
+				vals = append(vals, vm.strings[inst.Arg])
+				pos += l
+				pc++
+				continue
+			}
+			goto Fail
+		case OpChoice:
+			stack = append(stack, frame{pc: inst.Arg, pos: pos, vals: len(vals)})
+			pc++
+		case OpCommit:
+			stack = stack[:len(stack)-1]
+			pc = inst.Arg
+		case OpPartialCommit:
+			top := &stack[len(stack)-1]
+			top.pos = pos
+			top.vals = len(vals)
+			pc = inst.Arg
+		case OpBackCommit:
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			pos = top.pos
+			vals = vals[:top.vals]
+			pc = inst.Arg
+		case OpFail:
+			goto Fail
+		case OpFailTwice:
+			stack = stack[:len(stack)-1]
+			goto Fail
+		case OpJump:
+			pc = inst.Arg
+		case OpCall:
+			depth++
+			if vm.limits.MaxDepth > 0 && depth > vm.limits.MaxDepth {
+				return nil, ErrMaxDepth
+			}
+			stack = append(stack, frame{pc: pc + 1, call: true})
+			pc = inst.Arg
+		case OpReturn:
+			depth--
+			pc = stack[len(stack)-1].pc
+			stack = stack[:len(stack)-1]
+		case OpCapture:
+			var v interface{}
+			if actions != nil {
+				v = actions(inst.Arg, vals[len(vals)-inst.N:])
+			}
+			vals = append(vals[:len(vals)-inst.N], v)
+			pc++
+		case OpPredicate:
+			if actions != nil {
+				if ok, _ := actions(inst.Arg, vals[len(vals)-inst.N:]).(bool); !ok {
+					goto Fail
+				}
+			}
+			vals = append(vals, nil)
+			pc++
+		case OpPushNil:
+			vals = append(vals, nil)
+			pc++
+		case OpPushList:
+			vals = append(vals, []interface{}{})
+			pc++
+		case OpList:
+			vals[len(vals)-1] = []interface{}{vals[len(vals)-1]}
+			pc++
+		case OpAppend:
+			v := vals[len(vals)-1]
+			vals = vals[:len(vals)-1]
+			vals[len(vals)-1] = append(vals[len(vals)-1].([]interface{}), v)
+			pc++
+		case OpCover:
+			atomic.AddInt64(&prog.Cover[inst.Arg].Count, 1)
+			pc++
+		case OpEnd:
+			vm.end = pos
+			return vals[len(vals)-1], nil
+		default:
+			panic(fmt.Sprintf("VM: invalid instruction %v", inst))
+		}
+		continue
+
+	Fail:
+		for {
+			if len(stack) == 0 {
+				return nil, ErrNoMatch
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !top.call {
+				backtracks++
+				if vm.limits.MaxBacktracks > 0 && backtracks > vm.limits.MaxBacktracks {
+					return nil, ErrMaxBacktracks
+				}
+				pc, pos = top.pc, top.pos
+				vals = vals[:top.vals]
+				break
+			}
+			depth--
+		}
+	}
+}
+
+// hasPrefix reports whether src starts with str and the length of str in runes.
+func hasPrefix(src []rune, str string) (int, bool) {
+	l := 0
+	for _, r := range str {
+		if l >= len(src) || src[l] != r {
+			return 0, false
+		}
+		l++
+	}
+	return l, true
+}
+
+func (cr *CharRange) Match(c rune) bool {
+	for _, char := range cr.Chars {
+		if char.Start <= c && c <= char.End {
+			return !cr.Not
+		}
+	}
+	return cr.Not
+}
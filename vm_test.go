@@ -0,0 +1,27 @@
+package peg_test
+
+import (
+	"strings"
+	"testing"
+
+	peg "github.com/laurence6/PEG.go"
+)
+
+func TestVMMatchAllocs(t *testing.T) {
+	tree, err := peg.ReadTree(strings.NewReader(`
+A = ([a-z] / "-" / .) A / !.
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, _ := tree.Compile()
+
+	src := []rune(strings.Repeat("ab-c+", 1000))
+	if _, err := prog.Run(src, nil); err != nil {
+		t.Fatal(err)
+	}
+	// stacks grow in a few steps, and matched characters do not allocate
+	if allocs := testing.AllocsPerRun(10, func() { prog.Run(src, nil) }); allocs > 100 {
+		t.Errorf("%v allocations for %d characters", allocs, len(src))
+	}
+}
@@ -0,0 +1,148 @@
+package peg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+const importPath = "github.com/laurence6/PEG.go"
+
+const vmParseFunc = `
+var (
+	ErrMaxDepth      = __peg.ErrMaxDepth
+	ErrMaxBacktracks = __peg.ErrMaxBacktracks
+)
+
+func (p *Parser) ParseContext(ctx context.Context) (interface{}, error) {
+	p.p = &parser{src: p.src}
+	limits := __peg.Limits{
+		MaxDepth:      p.limits.maxDepth,
+		MaxBacktracks: p.limits.maxBacktracks,
+	}
+	r, err := __peg_prog.RunContext(ctx, p.src, p.p.action, limits)
+	if err == __peg.ErrNoMatch {
+		return nil, pegErr
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type parser struct {
+	src []rune
+}
+`
+
+// GenVMCode generates a parser running on the VM. The generated file holds
+// the compiled program and action code only.
+func (tree *Tree) GenVMCode(out io.Writer) {
+	tree.genImports(out, []string{"context"})
+	fmt.Fprintf(out, "import __peg %q\n", importPath)
+
+	if tree.Package == "main" {
+		fmt.Fprint(out, mainFunc)
+	}
+
+	fmt.Fprintf(out, header, "[]rune", "")
+	fmt.Fprint(out, vmParseFunc)
+	fmt.Fprint(out, valueFuncs)
+
+	prog, actions := tree.Compile()
+
+	fmt.Fprintln(out, "\nfunc (__p *parser) action(n int, v []interface{}) interface{} {")
+	fmt.Fprintln(out, "switch n {")
+	for n, a := range actions {
+		params := []string{}
+		args := []string{}
+		hasLabel := a.SeqExpr.hasLabel()
+		for i, le := range a.SeqExpr.LabeledExprs {
+			if a.Pred >= 0 && (i >= a.Pred || !hasLabel) {
+				break
+			}
+			if !hasLabel || le.Label != "" {
+				params = append(params, le.Label)
+				args = append(args, fmt.Sprintf("v[%d]", i))
+			}
+		}
+		fmt.Fprintf(out, "case %d:\n", n)
+		if a.Pred >= 0 {
+			fmt.Fprintf(out, "	return %s\n", genPredicate(a.SeqExpr.LabeledExprs[a.Pred].PrefixedExpr.SuffixedExpr.PrimaryExpr.Expr.(*CodeExpr).Code, params, args))
+		} else {
+			fmt.Fprintf(out, "	return %s\n", a.genValue(params, args))
+		}
+	}
+	fmt.Fprintln(out, "}")
+	fmt.Fprintln(out, "panic(\"unknown action\")")
+	fmt.Fprint(out, "}\n\n")
+
+	prog.GenCode(out)
+
+	if Coverage {
+		fmt.Fprint(out,
+			"// Coverage returns blocks of the grammar with counts of matches by all parses.\n"+
+				"func Coverage() []*__peg.CoverBlock {\n"+
+				"	return __peg_prog.Cover\n"+
+				"}\n\n"+
+				"// ResetCoverage sets counts of matches to zero.\n"+
+				"func ResetCoverage() {\n"+
+				"	__peg_prog.ResetCover()\n"+
+				"}\n\n",
+		)
+	}
+
+	fmt.Fprint(out, tree.Grammar.Code)
+
+	io.Copy(out, userCode)
+}
+
+func (prog *Program) GenCode(out io.Writer) {
+	fmt.Fprintln(out, "var __peg_prog = &__peg.Program{")
+
+	fmt.Fprintln(out, "Insts: []__peg.Inst{")
+	for pc, inst := range prog.Insts {
+		fmt.Fprintf(out, "{Op: %d, Arg: %d, N: %d}, // %d: %v\n", inst.Op, inst.Arg, inst.N, pc, inst)
+	}
+	fmt.Fprintln(out, "},")
+
+	fmt.Fprintln(out, "Strings: []string{")
+	for _, str := range prog.Strings {
+		fmt.Fprintf(out, "%q,\n", str)
+	}
+	fmt.Fprintln(out, "},")
+
+	fmt.Fprintln(out, "Classes: []*__peg.CharRange{")
+	for _, cr := range prog.Classes {
+		fmt.Fprintf(out, "{Not: %t, Chars: []*__peg.Char{", cr.Not)
+		for _, c := range cr.Chars {
+			fmt.Fprintf(out, "{Start: %s, End: %s}, ", strconv.QuoteRune(c.Start), strconv.QuoteRune(c.End))
+		}
+		fmt.Fprintln(out, "}},")
+	}
+	fmt.Fprintln(out, "},")
+
+	names := make([]string, 0, len(prog.Rules))
+	for name := range prog.Rules {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return prog.Rules[names[i]] < prog.Rules[names[j]]
+	})
+	fmt.Fprintln(out, "Rules: map[string]int{")
+	for _, name := range names {
+		fmt.Fprintf(out, "%q: %d,\n", name, prog.Rules[name])
+	}
+	fmt.Fprintln(out, "},")
+
+	if len(prog.Cover) > 0 {
+		fmt.Fprintln(out, "Cover: []*__peg.CoverBlock{")
+		for _, b := range prog.Cover {
+			fmt.Fprintf(out, "{Kind: %d, Rule: %q, Pos: __peg.Pos{Line: %d, Col: %d}, End: __peg.Pos{Line: %d, Col: %d}},\n",
+				b.Kind, b.Rule, b.Pos.Line, b.Pos.Col, b.End.Line, b.End.Col)
+		}
+		fmt.Fprintln(out, "},")
+	}
+
+	fmt.Fprint(out, "}\n\n")
+}
@@ -0,0 +1,195 @@
+package peg
+
+import "fmt"
+
+// Node is a node of the grammar AST: *Tree, *Grammar, *Import, *Rule,
+// *ChoiceExpr, *ActionExpr, *SeqExpr, *LabeledExpr, *PrefixedExpr,
+// *SuffixedExpr, *PrimaryExpr, or an Expr.
+type Node interface {
+	node()
+}
+
+func (*Tree) node()          {}
+func (*Grammar) node()       {}
+func (*Import) node()        {}
+func (*Rule) node()          {}
+func (*ChoiceExpr) node()    {}
+func (*ActionExpr) node()    {}
+func (*SeqExpr) node()       {}
+func (*LabeledExpr) node()   {}
+func (*PrefixedExpr) node()  {}
+func (*SuffixedExpr) node()  {}
+func (*PrimaryExpr) node()   {}
+func (*RuleRef) node()       {}
+func (*LitMatcher) node()    {}
+func (*ClassMatcher) node()  {}
+func (*AnyMatcher) node()    {}
+func (*KindMatcher) node()   {}
+func (*SubExpr) node()       {}
+func (*CodeExpr) node()      {}
+func (*StateCodeExpr) node() {}
+func (*IndentExpr) node()    {}
+func (*RecoverExpr) node()   {}
+func (*ThrowExpr) node()     {}
+
+// RuleRef returns the name of the rule referenced by pe, if it is a
+// reference.
+func (pe *PrimaryExpr) RuleRef() (string, bool) {
+	if ref, ok := pe.Expr.(*RuleRef); ok {
+		return ref.Name, true
+	}
+	return "", false
+}
+
+// A Visitor's Visit method is called for each node of Walk. If the result w
+// is not nil, Walk visits each child of node with w, followed by a call of
+// w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, in the order of the grammar:
+// it starts by calling v.Visit(node), and unless it returns nil, walks each
+// child of node with the returned visitor, followed by a call of
+// w.Visit(nil).
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Tree:
+		Walk(v, n.Grammar)
+	case *Grammar:
+		for _, i := range n.Import {
+			Walk(v, i)
+		}
+		if n.Skip != nil {
+			Walk(v, n.Skip)
+		}
+		for _, r := range n.RuleList {
+			Walk(v, r)
+		}
+	case *Rule:
+		Walk(v, n.ChoiceExpr)
+	case *ChoiceExpr:
+		for _, ae := range n.ActionExprs {
+			Walk(v, ae)
+		}
+	case *ActionExpr:
+		Walk(v, n.SeqExpr)
+	case *SeqExpr:
+		for _, le := range n.LabeledExprs {
+			Walk(v, le)
+		}
+	case *LabeledExpr:
+		Walk(v, n.PrefixedExpr)
+	case *PrefixedExpr:
+		Walk(v, n.SuffixedExpr)
+	case *SuffixedExpr:
+		Walk(v, n.PrimaryExpr)
+	case *PrimaryExpr:
+		if n.Expr != nil {
+			Walk(v, n.Expr)
+		}
+	case *SubExpr:
+		Walk(v, n.ChoiceExpr)
+	case *Import, *RuleRef, *LitMatcher, *ClassMatcher, *AnyMatcher, *KindMatcher, *CodeExpr, *StateCodeExpr, *IndentExpr, *RecoverExpr, *ThrowExpr:
+		// leaves
+	default:
+		panic(fmt.Sprintf("Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order like Walk: it starts by
+// calling f(node), and if f returns true, inspects each child of node,
+// followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite traverses an AST in depth-first order, replacing each node, after
+// its children, with the result of f. A child in a list, like a rule or an
+// alternative, is removed if f returns nil. Other children should be
+// replaced with nodes of their own type, or, in PrimaryExpr, with an Expr.
+// Rewrite returns the result of f(node).
+func Rewrite(node Node, f func(Node) Node) Node {
+	switch n := node.(type) {
+	case *Tree:
+		n.Grammar = rewriteChild(n.Grammar, f).(*Grammar)
+	case *Grammar:
+		imports := []*Import{}
+		for _, i := range n.Import {
+			if i, ok := Rewrite(i, f).(*Import); ok {
+				imports = append(imports, i)
+			}
+		}
+		n.Import = imports
+		if n.Skip != nil {
+			n.Skip, _ = Rewrite(n.Skip, f).(*ChoiceExpr)
+		}
+		rules := []*Rule{}
+		for _, r := range n.RuleList {
+			if r, ok := Rewrite(r, f).(*Rule); ok {
+				rules = append(rules, r)
+			}
+		}
+		n.RuleList = rules
+	case *Rule:
+		n.ChoiceExpr = rewriteChild(n.ChoiceExpr, f).(*ChoiceExpr)
+	case *ChoiceExpr:
+		aes := []*ActionExpr{}
+		for _, ae := range n.ActionExprs {
+			if ae, ok := Rewrite(ae, f).(*ActionExpr); ok {
+				aes = append(aes, ae)
+			}
+		}
+		n.ActionExprs = aes
+	case *ActionExpr:
+		n.SeqExpr = rewriteChild(n.SeqExpr, f).(*SeqExpr)
+	case *SeqExpr:
+		les := []*LabeledExpr{}
+		for _, le := range n.LabeledExprs {
+			if le, ok := Rewrite(le, f).(*LabeledExpr); ok {
+				les = append(les, le)
+			}
+		}
+		n.LabeledExprs = les
+	case *LabeledExpr:
+		n.PrefixedExpr = rewriteChild(n.PrefixedExpr, f).(*PrefixedExpr)
+	case *PrefixedExpr:
+		n.SuffixedExpr = rewriteChild(n.SuffixedExpr, f).(*SuffixedExpr)
+	case *SuffixedExpr:
+		n.PrimaryExpr = rewriteChild(n.PrimaryExpr, f).(*PrimaryExpr)
+	case *PrimaryExpr:
+		n.upgrade()
+		if n.Expr != nil {
+			n.Expr = rewriteChild(n.Expr, f).(Expr)
+			n.sync()
+		}
+	case *SubExpr:
+		n.ChoiceExpr = rewriteChild(n.ChoiceExpr, f).(*ChoiceExpr)
+	}
+
+	return f(node)
+}
+
+// rewriteChild rewrites a child which cannot be removed.
+func rewriteChild(node Node, f func(Node) Node) Node {
+	n := Rewrite(node, f)
+	if n == nil {
+		panic(fmt.Sprintf("Rewrite: %T removed", node))
+	}
+	return n
+}